@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	logs := &bytes.Buffer{}
+	withConfig(t, audited(
+		WithAccessLogger(slog.New(slog.NewJSONHandler(logs, nil))),
+		WithLogger(slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))),
+	)...)
+	cases := []struct {
+		h      http.Handler
+		r      *http.Request
+		level  string
+		route  string
+		method string
+		status float64
+		err    string
+	}{
+		{NewShopApi(), httptest.NewRequest("GET", "/shop/items/7", nil), "INFO", "/shop/items/{id}", "Item", 200, ""},
+		{NewMyApi(), httptest.NewRequest("GET", "/user/profile", nil), "INFO", "/user/profile", "Profile", 400, "login must me not empty"},
+		{NewAdminApi(), crash(), "ERROR", "/admin/crash", "Crash", 500, "internal error"},
+	}
+	for _, c := range cases {
+		logs.Reset()
+		c.r.RemoteAddr = "192.0.2.1:1234"
+		w := serve(c.h, c.r)
+		record := map[string]interface{}{}
+		if err := json.Unmarshal(logs.Bytes(), &record); err != nil {
+			t.Errorf("%s: %s in %q", c.method, err, logs.String())
+			continue
+		}
+		want := map[string]interface{}{
+			"level": c.level, "msg": "request", "route": c.route, "method": c.method, "http_method": c.r.Method,
+			"status": c.status, "bytes": float64(w.Body.Len()), "remote_addr": "192.0.2.1:1234",
+			"request_id": w.Header().Get("X-Request-ID"),
+		}
+		if c.err != "" {
+			want["error"] = c.err
+		}
+		for key, value := range want {
+			if record[key] != value {
+				t.Errorf("%s: %s is %v, want %v", c.method, key, record[key], value)
+			}
+		}
+		if _, ok := record["latency"]; !ok || len(record) != len(want)+2 {
+			t.Errorf("%s: %v", c.method, record)
+		}
+	}
+}
+
+func TestAccessLogOff(t *testing.T) {
+	withConfig(t)
+	if DefaultHandlerConfig.AccessLogger != nil {
+		t.Error("access logs are on by default")
+	}
+	if w := serve(NewShopApi(), httptest.NewRequest("GET", "/shop/items/7", nil)); w.Code != 200 {
+		t.Errorf("%d %s", w.Code, w.Body.String())
+	}
+}
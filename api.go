@@ -3,8 +3,10 @@ package main
 import (
 	"context"
 	"fmt"
+	"mime/multipart"
 	"net/http"
 	"sync"
+	"time"
 )
 
 // вы можете использовать ApiError в коде, который получается в результате генерации
@@ -153,3 +155,206 @@ func (srv *OtherApi) Create(ctx context.Context, in OtherCreateParams) (*OtherUs
 		Level:    in.Level,
 	}, nil
 }
+
+// ShopApi shows the options of apigen:service, its methods take them as defaults
+// apigen:service {"prefix": "/shop", "cors": {"origins": ["https://shop.example", "https://admin.example"], "headers": ["X-Auth"]}}
+type ShopApi struct{}
+
+func NewShopApi() *ShopApi {
+	return &ShopApi{}
+}
+
+type ItemParams struct {
+	ID string `apivalidator:"required"`
+}
+
+type Item struct {
+	ID string `json:"id"`
+}
+
+// apigen:api {"url": "/public", "method": "GET", "cors": {"origins": ["*"]}}
+func (srv *ShopApi) Public(ctx context.Context, in ItemParams) (*Item, error) {
+	return &Item{ID: in.ID}, nil
+}
+
+// apigen:api {"url": "/items/{id}", "method": "GET"}
+func (srv *ShopApi) Item(ctx context.Context, in ItemParams) (*Item, error) {
+	return &Item{ID: in.ID}, nil
+}
+
+// static segments win over {id}
+type FeaturedParams struct{}
+
+// apigen:api {"url": "/items/featured", "method": "GET"}
+func (srv *ShopApi) Featured(ctx context.Context, in FeaturedParams) (*Item, error) {
+	return &Item{ID: "featured"}, nil
+}
+
+type DownloadParams struct {
+	Path string `apivalidator:"required"`
+}
+
+// apigen:api {"url": "/files/{path...}", "method": "GET"}
+func (srv *ShopApi) Download(ctx context.Context, in DownloadParams) (*Item, error) {
+	return &Item{ID: in.Path}, nil
+}
+
+type AccountParams struct {
+	Currency string `apivalidator:"enum=usd|eur,default=usd"`
+}
+
+type Account struct {
+	Currency string `json:"currency"`
+}
+
+// apigen:api {"url": "/account", "method": "GET", "auth": true, "auth_scheme": "basic"}
+func (srv *ShopApi) Account(ctx context.Context, in AccountParams) (*Account, error) {
+	return &Account{Currency: in.Currency}, nil
+}
+
+// apigen:api {"url": "/account/balance", "method": "GET", "auth": true, "auth_scheme": "query"}
+func (srv *ShopApi) Balance(ctx context.Context, in AccountParams) (*Account, error) {
+	return &Account{Currency: in.Currency}, nil
+}
+
+// apigen:api {"url": "/account/history", "method": "GET", "auth": true, "auth_scheme": "cookie"}
+func (srv *ShopApi) History(ctx context.Context, in AccountParams) (*Account, error) {
+	return &Account{Currency: in.Currency}, nil
+}
+
+// тело можно прислать формой или JSON'ом: {"item": "42", "count": 2}
+type OrderParams struct {
+	Item  string `apivalidator:"required"`
+	Count int    `apivalidator:"min=1,max=10"`
+}
+
+type Order struct {
+	Item  string `json:"item"`
+	Count int    `json:"count"`
+}
+
+// apigen:api {"url": "/orders", "method": "POST", "max_body": "16KB", "rate_limit": {"rps": 1, "burst": 2}}
+func (srv *ShopApi) Order(ctx context.Context, in OrderParams) (*Order, error) {
+	return &Order{Item: in.Item, Count: in.Count}, nil
+}
+
+// clients of Search are told apart by their API keys, ones without a key by ip
+type SearchParams struct {
+	Query string `apivalidator:"paramname=q,required"`
+}
+
+// apigen:api {"url": "/search", "method": "GET", "rate_limit": {"rps": 1, "burst": 1, "key": "header:X-Api-Key"}}
+func (srv *ShopApi) Search(ctx context.Context, in SearchParams) (*Item, error) {
+	return &Item{ID: in.Query}, nil
+}
+
+// Wait is how long the pricing service takes to answer, in ms
+type QuoteParams struct {
+	Item string `apivalidator:"required"`
+	Wait int    `apivalidator:"min=0,max=1000"`
+}
+
+// apigen:api {"url": "/quote", "method": "GET", "timeout": "50ms"}
+func (srv *ShopApi) Quote(ctx context.Context, in QuoteParams) (*Order, error) {
+	select {
+	case <-time.After(time.Duration(in.Wait) * time.Millisecond):
+		return &Order{Item: in.Item, Count: 1}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// apigen:api {"url": "/checkout", "method": "POST", "max_concurrency": 1, "queue_wait": "20ms"}
+func (srv *ShopApi) Checkout(ctx context.Context, in OrderParams) (*Order, error) {
+	return &Order{Item: in.Item, Count: in.Count}, nil
+}
+
+// every param of AddToCart has its own source
+type CartParams struct {
+	Cart    string `apivalidator:"paramname=id,in=path"`
+	Item    string `apivalidator:"in=body,required"`
+	Coupon  string `apivalidator:"in=query"`
+	Session string `apivalidator:"in=cookie,required"`
+	Version string `apivalidator:"paramname=X-Client-Version,in=header,min=1"`
+}
+
+type CartItem struct {
+	Cart    string `json:"cart"`
+	Item    string `json:"item"`
+	Coupon  string `json:"coupon"`
+	Session string `json:"session"`
+	Version string `json:"version"`
+}
+
+// apigen:api {"url": "/carts/{id}/items", "method": "POST"}
+func (srv *ShopApi) AddToCart(ctx context.Context, in CartParams) (*CartItem, error) {
+	return &CartItem{Cart: in.Cart, Item: in.Item, Coupon: in.Coupon, Session: in.Session, Version: in.Version}, nil
+}
+
+type PhotoParams struct {
+	ID     string                  `apivalidator:"required"`
+	Photo  *multipart.FileHeader   `apivalidator:"required,max_size=1MB,types=image/png|image/jpeg"`
+	Thumbs []*multipart.FileHeader `apivalidator:"max_count=2,max_size=64KB,types=image/*"`
+}
+
+type Photo struct {
+	ID     string `json:"id"`
+	Size   int64  `json:"size"`
+	Thumbs int    `json:"thumbs"`
+}
+
+// apigen:api {"url": "/items/{id}/photo", "method": "POST", "max_body": "2MB"}
+func (srv *ShopApi) Photo(ctx context.Context, in PhotoParams) (*Photo, error) {
+	return &Photo{ID: in.ID, Size: in.Photo.Size, Thumbs: len(in.Thumbs)}, nil
+}
+
+type PaymentParams struct {
+	Order  string `apivalidator:"required"`
+	Status string `apivalidator:"enum=paid|failed"`
+}
+
+// apigen:api {"url": "/hooks/payment", "method": "POST", "signature": {"header": "X-Signature", "algo": "sha256"}}
+func (srv *ShopApi) Payment(ctx context.Context, in PaymentParams) (*Order, error) {
+	return &Order{Item: in.Order}, nil
+}
+
+// SignatureSecret is the key of payment webhooks, a real one comes from the config
+func (srv *ShopApi) SignatureSecret(r *http.Request, method string) ([]byte, error) {
+	return []byte("shop-secret"), nil
+}
+
+// AdminApi shows middlewares, "audit" comes from WithNamedMiddleware
+// apigen:service {"prefix": "/admin", "auth": true, "middleware": ["audit"]}
+type AdminApi struct{}
+
+func NewAdminApi() *AdminApi {
+	return &AdminApi{}
+}
+
+type StatsParams struct {
+	Period string `apivalidator:"enum=day|week,default=day"`
+}
+
+type Stats struct {
+	Period string `json:"period"`
+}
+
+// apigen:api {"url": "/stats", "method": "GET"}
+func (srv *AdminApi) Stats(ctx context.Context, in StatsParams) (*Stats, error) {
+	return &Stats{Period: in.Period}, nil
+}
+
+// apigen:api {"url": "/reindex", "method": "POST", "middleware": ["confirm"]}
+func (srv *AdminApi) Reindex(ctx context.Context, in StatsParams) (*Stats, error) {
+	return &Stats{Period: in.Period}, nil
+}
+
+// apigen:api {"url": "/report", "method": "GET", "rate_limit": {"rps": 1, "burst": 1, "key": "principal"}}
+func (srv *AdminApi) Report(ctx context.Context, in StatsParams) (*Stats, error) {
+	return &Stats{Period: in.Period}, nil
+}
+
+// apigen:api {"url": "/crash", "method": "POST"}
+func (srv *AdminApi) Crash(ctx context.Context, in StatsParams) (*Stats, error) {
+	panic("stats of " + in.Period + " are broken")
+}
@@ -1,328 +1,4494 @@
 package main
 
 import (
-	"strconv"
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"net/url"
+	"path"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Result from wrappers
-type resValue map[string]interface{}
+type apigenResValue map[string]interface{}
 
-// ...
-// generated for type: MyApi
-// ...
+// AuthCredential is what the authorization checker read from the request:
+// Token for header (X-Auth), query (?api_key=) and cookie (api_key) schemes,
+// User and Password for basic
+type AuthCredential struct {
+	Scheme   string
+	Token    string
+	User     string
+	Password string
+}
 
-// main.methodOptions{URL:"/user/profile", Auth:false, Method:""}
-// [Wrapper for MyApi] method: Profile
-func (node *MyApi) wrapperProfile(w http.ResponseWriter, r *http.Request) {
-	// validation ProfileParams
-	r.ParseForm()
-	paramLogin := r.Form.Get("login")
-	// tplRequired
-	if paramLogin == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		data, _ := json.Marshal(resValue{"error": "login must me not empty"})
-		io.WriteString(w, string(data))
+// AuthVerifier decides whether the credential is good enough,
+// it's used by every wrapper with "auth": true, whatever the scheme
+type AuthVerifier func(r *http.Request, cred AuthCredential) bool
+
+// DefaultAuthVerifier accepts the 100500 token (or password for basic)
+func DefaultAuthVerifier(r *http.Request, cred AuthCredential) bool {
+	if cred.Scheme == "basic" {
+		return cred.Password == "100500"
+	}
+	return cred.Token == "100500"
+}
+
+// ErrorEncoder writes every error response of generated handlers
+type ErrorEncoder func(w http.ResponseWriter, r *http.Request, status int, err error)
+
+// DefaultErrorEncoder writes {"error": "<err>", "request_id": "<id>"} with status
+func DefaultErrorEncoder(w http.ResponseWriter, r *http.Request, status int, err error) {
+	res := apigenResValue{"error": err.Error()}
+	if id := RequestIDFromContext(r.Context()); id != "" {
+		res["request_id"] = id
+	}
+	data, _ := json.Marshal(res)
+	w.WriteHeader(status)
+	io.WriteString(w, string(data))
+}
+
+// HandlerConfig is what generated handlers do at runtime, make it with NewHandlerConfig
+type HandlerConfig struct {
+	AuthVerifier AuthVerifier // checks credentials of "auth": true methods
+	ErrorEncoder ErrorEncoder // writes validation, auth and method errors
+	Logger       *slog.Logger // gets method errors that are not ApiError
+	MaxBodySize  int64        // body limit of methods without "max_body", 0 means no limit
+	// bytes of multipart forms kept in memory, files over it go to temp files
+	MultipartMemory int64
+	NotFound        http.Handler // serves unknown paths, "unknown method" error if nil
+
+	// request ID is read from this header or generated, echoed in it and put into ctx,
+	// "" turns request IDs off
+	RequestIDHeader string
+
+	// one record per request of every wrapper, nil turns access logs off
+	AccessLogger *slog.Logger
+	// request counts, latencies and in-flight requests, DefaultMetrics unless changed, nil turns them off
+	Metrics *Metrics
+	// starts a span for every request continuing W3C traceparent, nil turns tracing off
+	Tracer Tracer
+	// token buckets of "rate_limit" methods, in-memory unless changed, nil turns rate limits off
+	RateLimitStore RateLimitStore
+	// CORS policy of methods without "cors" in apigen:api, nil allows no cross-origin requests
+	CORS *CORSPolicy
+	// header with a timeout of the client like "1.5s", capped by "timeout" of the method, "" ignores it
+	DeadlineHeader string
+
+	// panics of wrappers, middlewares and methods are logged with the stack
+	// and answered with 500 unless DisableRecovery is set
+	DisableRecovery bool
+
+	// middlewares run in this order after auth, method and signature checks
+	Middlewares        []Middleware            // for every method
+	ServiceMiddlewares map[string][]Middleware // for methods of the API type
+	NamedMiddlewares   map[string]Middleware   // registry for "middleware" of apigen:api
+
+	chains *apigenChainCache // middleware chains of methods, made by NewHandlerConfig
+}
+
+// apigenStatusWriter remembers the response for access logs
+type apigenStatusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+	err    error // the error given to ErrorEncoder
+}
+
+func (sw *apigenStatusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *apigenStatusWriter) Write(data []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	n, err := sw.ResponseWriter.Write(data)
+	sw.bytes += int64(n)
+	return n, err
+}
+
+func (sw *apigenStatusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// writeError gives err to ErrorEncoder and remembers it for logs,
+// w may be wrapped by middlewares that have Unwrap
+func (cfg *HandlerConfig) writeError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	for next := w; next != nil; {
+		if sw, ok := next.(*apigenStatusWriter); ok {
+			sw.err = err
+			break
+		}
+		unwrapper, ok := next.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		next = unwrapper.Unwrap()
+	}
+	cfg.ErrorEncoder(w, r, status, err)
+}
+
+type apigenRequestIDKey struct{}
+
+// RequestIDFromContext returns the ID of the request, "" if there is none
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(apigenRequestIDKey{}).(string)
+	return id
+}
+
+// withRequestID reuses a sane ID of the client or makes a new one,
+// requests that got an ID from ServeHTTP keep it
+func (cfg *HandlerConfig) withRequestID(w http.ResponseWriter, r *http.Request) *http.Request {
+	if RequestIDFromContext(r.Context()) != "" {
+		return r
+	}
+	id := r.Header.Get(cfg.RequestIDHeader)
+	if !apigenValidRequestID(id) {
+		var raw [16]byte
+		rand.Read(raw[:])
+		id = hex.EncodeToString(raw[:])
+	}
+	w.Header().Set(cfg.RequestIDHeader, id)
+	return r.WithContext(context.WithValue(r.Context(), apigenRequestIDKey{}, id))
+}
+
+func apigenValidRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// DefaultMultipartMemory is what ParseMultipartForm keeps in memory by default, the rest goes to temp files
+const DefaultMultipartMemory = 32 << 20
+
+// apigenRequestValues are params of the request by where they come from
+type apigenRequestValues struct {
+	query url.Values
+	body  url.Values
+}
+
+// Get returns the value from the body or, if it has none, from the query like r.Form
+func (values apigenRequestValues) Get(key string) string {
+	if body := values.body[key]; len(body) > 0 {
+		return body[0]
+	}
+	return values.query.Get(key)
+}
+
+// bindValues reads params of the request: the query and, for POST, PUT and PATCH,
+// the body chosen by Content-Type - a form or a JSON object with paramname keys.
+// Scalars of JSON are bound as their text, so the same validation runs for every format,
+// keys that are not in params may hold anything and are skipped.
+// It answers errors itself, ok is false then
+func (cfg *HandlerConfig) bindValues(w http.ResponseWriter, r *http.Request, params []string) (values apigenRequestValues, ok bool) {
+	query, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("bad query"))
+		return values, false
+	}
+	values.query = query
+	mediaType := ""
+	if r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch {
+		if contentType := r.Header.Get("Content-Type"); contentType != "" {
+			if mediaType, _, err = mime.ParseMediaType(contentType); err != nil {
+				cfg.writeError(w, r, http.StatusUnsupportedMediaType, errors.New("unsupported content type"))
+				return values, false
+			}
+		}
+	}
+	switch {
+	case mediaType == "" || mediaType == "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			cfg.writeBodyError(w, r, err, "bad form")
+			return values, false
+		}
+		values.body = r.PostForm
+		return values, true
+	case mediaType == "multipart/form-data":
+		if err := r.ParseMultipartForm(cfg.MultipartMemory); err != nil {
+			cfg.writeBodyError(w, r, err, "bad form")
+			return values, false
+		}
+		values.body = r.PostForm
+		return values, true
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		body := map[string]any{}
+		decoder := json.NewDecoder(r.Body)
+		decoder.UseNumber()
+		if err := decoder.Decode(&body); err != nil {
+			cfg.writeBodyError(w, r, err, "bad json")
+			return values, false
+		}
+		values.body = url.Values{}
+		for _, key := range params {
+			value, ok := body[key]
+			if !ok {
+				continue
+			}
+			str := ""
+			switch value := value.(type) {
+			case nil:
+			case string:
+				str = value
+			case json.Number:
+				str = value.String()
+			case bool:
+				str = strconv.FormatBool(value)
+			default:
+				cfg.writeError(w, r, http.StatusBadRequest, errors.New(key+" must be a scalar"))
+				return values, false
+			}
+			values.body.Set(key, str)
+		}
+		return values, true
+	}
+	cfg.writeError(w, r, http.StatusUnsupportedMediaType, errors.New("unsupported content type"))
+	return values, false
+}
+
+// apigenCookieValue is the value of the cookie, "" if there is none
+func apigenCookieValue(r *http.Request, name string) string {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// writeBodyError answers 413 if the body is over the limit and 400 with msg otherwise
+func (cfg *HandlerConfig) writeBodyError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		cfg.writeError(w, r, http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+		return
+	}
+	cfg.writeError(w, r, http.StatusBadRequest, errors.New(msg))
+}
+
+// methodContext bounds ctx of the method by timeout of the annotation (0 if none)
+// and by the deadline header of the client, whichever is shorter
+func (cfg *HandlerConfig) methodContext(r *http.Request, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if cfg.DeadlineHeader != "" {
+		client, err := time.ParseDuration(r.Header.Get(cfg.DeadlineHeader))
+		if err == nil && client > 0 && (timeout == 0 || client < timeout) {
+			timeout = client
+		}
+	}
+	if timeout == 0 {
+		return r.Context(), func() {}
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
+
+// logAccess is deferred by every wrapper
+func (cfg *HandlerConfig) logAccess(sw *apigenStatusWriter, r *http.Request, route, method string, start time.Time) {
+	if cfg.AccessLogger == nil {
+		return
+	}
+	status := sw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	attrs := []slog.Attr{
+		slog.String("route", route),
+		slog.String("method", method),
+		slog.String("http_method", r.Method),
+		slog.Int("status", status),
+		slog.Duration("latency", time.Since(start)),
+		slog.Int64("bytes", sw.bytes),
+		slog.String("remote_addr", r.RemoteAddr),
+	}
+	if id := RequestIDFromContext(r.Context()); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	level := slog.LevelInfo
+	if sw.err != nil {
+		attrs = append(attrs, slog.String("error", sw.err.Error()))
+	}
+	if status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	cfg.AccessLogger.LogAttrs(r.Context(), level, "request", attrs...)
+}
+
+// recoverPanic is deferred by every wrapper
+func (cfg *HandlerConfig) recoverPanic(w http.ResponseWriter, r *http.Request, method string) {
+	rec := recover()
+	if rec == nil {
+		return
+	}
+	if rec == http.ErrAbortHandler {
+		panic(rec)
+	}
+	cfg.Logger.Error("panic in handler", "method", method, "request_id", RequestIDFromContext(r.Context()), "panic", rec, "stack", string(debug.Stack()))
+	cfg.writeError(w, r, http.StatusInternalServerError, errors.New("internal error"))
+}
+
+// Middleware wraps binding params, calling the method and writing the response
+type Middleware func(next http.Handler) http.Handler
+
+// apigenChainSpec is the middleware chain of one method, handler makes its innermost
+// handler calling the method of the API value the wrapper put into ctx
+type apigenChainSpec struct {
+	service        string
+	names          []string
+	handler        func(cfg *HandlerConfig) http.Handler
+	maxConcurrency int // "max_concurrency" of the method, 0 means no limit
+}
+
+// apigenChainState is what a config built for one method
+type apigenChainState struct {
+	handler http.Handler  // the middleware chain
+	slots   chan struct{} // calls in flight, nil without "max_concurrency"
+}
+
+// apigenNodeKey holds the API value of the request, so one chain serves all of them
+type apigenNodeKey struct{}
+
+// apigenChainCache keeps chains built by constructors or on first use
+type apigenChainCache struct {
+	mu     sync.RWMutex
+	states map[*apigenChainSpec]*apigenChainState
+}
+
+// buildChain wraps the method with global, service and method middlewares
+func (cfg *HandlerConfig) buildChain(spec *apigenChainSpec) (http.Handler, error) {
+	h := spec.handler(cfg)
+	for i := len(spec.names) - 1; i >= 0; i-- {
+		mw, ok := cfg.NamedMiddlewares[spec.names[i]]
+		if !ok {
+			return nil, errors.New("unknown middleware " + spec.names[i] + " of " + spec.service)
+		}
+		h = mw(h)
+	}
+	for i := len(cfg.ServiceMiddlewares[spec.service]) - 1; i >= 0; i-- {
+		h = cfg.ServiceMiddlewares[spec.service][i](h)
+	}
+	for i := len(cfg.Middlewares) - 1; i >= 0; i-- {
+		h = cfg.Middlewares[i](h)
+	}
+	return h, nil
+}
+
+// mustBuildChains builds chains once for constructors, unknown middlewares panic
+func (cfg *HandlerConfig) mustBuildChains(specs []*apigenChainSpec) {
+	for _, spec := range specs {
+		h, err := cfg.buildChain(spec)
+		if err != nil {
+			panic("apigen: " + err.Error())
+		}
+		cfg.storeChain(spec, h)
+	}
+}
+
+// storeChain keeps the chain of the first call, so all requests share the slots
+func (cfg *HandlerConfig) storeChain(spec *apigenChainSpec, h http.Handler) *apigenChainState {
+	state := &apigenChainState{handler: h}
+	if spec.maxConcurrency > 0 {
+		state.slots = make(chan struct{}, spec.maxConcurrency)
+	}
+	if cfg.chains == nil {
+		return state
+	}
+	cfg.chains.mu.Lock()
+	defer cfg.chains.mu.Unlock()
+	if cfg.chains.states == nil {
+		cfg.chains.states = map[*apigenChainSpec]*apigenChainState{}
+	}
+	if stored := cfg.chains.states[spec]; stored != nil {
+		return stored
+	}
+	cfg.chains.states[spec] = state
+	return state
+}
+
+// chain returns the chain of the method and its slots, configs not passed to a constructor
+// build them on first use and answer 500 for unknown middlewares.
+// HandlerConfig literals have no cache, chains and slots are made per request then
+func (cfg *HandlerConfig) chain(spec *apigenChainSpec) *apigenChainState {
+	if cfg.chains != nil {
+		cfg.chains.mu.RLock()
+		state := cfg.chains.states[spec]
+		cfg.chains.mu.RUnlock()
+		if state != nil {
+			return state
+		}
+	}
+	h, err := cfg.buildChain(spec)
+	if err != nil {
+		cfg.Logger.Error("bad handler config", "service", spec.service, "error", err)
+		h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cfg.writeError(w, r, http.StatusInternalServerError, err)
+		})
+	}
+	return cfg.storeChain(spec, h)
+}
+
+// HandlerOption changes HandlerConfig
+type HandlerOption func(cfg *HandlerConfig)
+
+func WithAuthVerifier(verifier AuthVerifier) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.AuthVerifier = verifier }
+}
+
+func WithErrorEncoder(encoder ErrorEncoder) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.ErrorEncoder = encoder }
+}
+
+func WithLogger(logger *slog.Logger) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.Logger = logger }
+}
+
+// DefaultMaxBodySize is the body limit of NewHandlerConfig, the form limit of net/http
+const DefaultMaxBodySize = 10 << 20
+
+// WithMaxBodySize changes the body limit of methods without "max_body", 0 turns it off
+func WithMaxBodySize(size int64) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.MaxBodySize = size }
+}
+
+// WithMultipartMemory changes bytes of multipart forms kept in memory
+func WithMultipartMemory(size int64) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.MultipartMemory = size }
+}
+
+func WithNotFound(handler http.Handler) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.NotFound = handler }
+}
+
+// WithRequestIDHeader changes X-Request-ID, "" turns request IDs off
+func WithRequestIDHeader(header string) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.RequestIDHeader = header }
+}
+
+// WithRateLimitStore changes where token buckets of rate limits are kept, nil turns rate limits off
+func WithRateLimitStore(store RateLimitStore) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.RateLimitStore = store }
+}
+
+// WithDeadlineHeader lets clients shorten ctx of methods by a timeout in header
+func WithDeadlineHeader(header string) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.DeadlineHeader = header }
+}
+
+// WithCORS sets CORS policy of methods without "cors" in apigen:api
+// It panics if policy allows credentials from any origin ("*"), that lets any site act as the user
+func WithCORS(policy *CORSPolicy) HandlerOption {
+	if policy != nil && policy.AllowCredentials && apigenContains(policy.AllowOrigins, "*") {
+		panic("apigen: CORS policy with AllowCredentials can't allow any origin")
+	}
+	return func(cfg *HandlerConfig) { cfg.CORS = policy }
+}
+
+func WithTracer(tracer Tracer) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.Tracer = tracer }
+}
+
+func WithMetrics(metrics *Metrics) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.Metrics = metrics }
+}
+
+func WithAccessLogger(logger *slog.Logger) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.AccessLogger = logger }
+}
+
+// WithoutRecovery lets panics go to net/http
+func WithoutRecovery() HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.DisableRecovery = true }
+}
+
+func WithMiddleware(mws ...Middleware) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.Middlewares = append(cfg.Middlewares, mws...) }
+}
+
+// WithServiceMiddleware adds middlewares for methods of the API type named service
+func WithServiceMiddleware(service string, mws ...Middleware) HandlerOption {
+	return func(cfg *HandlerConfig) {
+		if cfg.ServiceMiddlewares == nil {
+			cfg.ServiceMiddlewares = map[string][]Middleware{}
+		}
+		cfg.ServiceMiddlewares[service] = append(cfg.ServiceMiddlewares[service], mws...)
+	}
+}
+
+// WithNamedMiddleware registers mw for "middleware": ["name"] of apigen:api
+func WithNamedMiddleware(name string, mw Middleware) HandlerOption {
+	return func(cfg *HandlerConfig) {
+		if cfg.NamedMiddlewares == nil {
+			cfg.NamedMiddlewares = map[string]Middleware{}
+		}
+		cfg.NamedMiddlewares[name] = mw
+	}
+}
+
+// NewHandlerConfig makes the default config changed by opts
+func NewHandlerConfig(opts ...HandlerOption) HandlerConfig {
+	cfg := HandlerConfig{
+		AuthVerifier:    DefaultAuthVerifier,
+		ErrorEncoder:    DefaultErrorEncoder,
+		Logger:          slog.Default(),
+		Metrics:         DefaultMetrics,
+		MaxBodySize:     DefaultMaxBodySize,
+		MultipartMemory: DefaultMultipartMemory,
+		RequestIDHeader: "X-Request-ID",
+		RateLimitStore:  NewMemoryRateLimitStore(),
+		chains:          &apigenChainCache{},
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// DefaultHandlerConfig is used by ServeHTTP of API types, change it before serving
+var DefaultHandlerConfig = NewHandlerConfig()
+
+// Route is one generated method for any router, made by Routes()
+type Route struct {
+	Method      string           // HTTP method, empty means any
+	Pattern     string           // url with {name} segments, service prefix included
+	Handler     http.HandlerFunc // the wrapper with all the checks
+	Service     string           // API type
+	Name        string           // Go method
+	Auth        bool
+	AuthScheme  string
+	ParamStruct string       // type of the method params
+	Params      []RouteParam // fields of ParamStruct
+}
+
+// RouteParam tells where a field of the params struct is read from
+type RouteParam struct {
+	Name string // paramname
+	In   string // query, body, header, cookie, path or "" for the body or the query
+}
+
+// apigenLatencyBuckets are upper bounds of the latency histogram in seconds
+var apigenLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics of generated handlers, labels are the annotation url and the Go method
+// so the number of series is bounded by the generated code
+type Metrics struct {
+	mu     sync.RWMutex
+	routes map[apigenMetricsKey]*apigenRouteMetrics
+}
+
+type apigenMetricsKey struct {
+	route  string
+	method string
+}
+
+type apigenRouteMetrics struct {
+	inFlight atomic.Int64
+	statuses [6]atomic.Uint64 // by status class, 1xx - 5xx, 0 for anything else
+	buckets  []atomic.Uint64  // per latency bucket, the last one is +Inf
+	count    atomic.Uint64
+	sumNanos atomic.Int64
+	shed     atomic.Uint64 // turned away by "max_concurrency"
+}
+
+// DefaultMetrics is what HandlerConfig gets by default and what MetricsHandler serves
+var DefaultMetrics = NewMetrics()
+
+func NewMetrics() *Metrics {
+	return &Metrics{routes: map[apigenMetricsKey]*apigenRouteMetrics{}}
+}
+
+// MetricsHandler serves DefaultMetrics in Prometheus text format
+func MetricsHandler() http.Handler {
+	return DefaultMetrics
+}
+
+// route returns metrics of the route, they are made on the first request
+func (m *Metrics) route(route, method string) *apigenRouteMetrics {
+	key := apigenMetricsKey{route, method}
+	m.mu.RLock()
+	rm := m.routes[key]
+	m.mu.RUnlock()
+	if rm != nil {
+		return rm
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if rm = m.routes[key]; rm == nil {
+		rm = &apigenRouteMetrics{buckets: make([]atomic.Uint64, len(apigenLatencyBuckets)+1)}
+		m.routes[key] = rm
+	}
+	return rm
+}
+
+// start counts the request in flight, nil Metrics do nothing
+func (m *Metrics) start(route, method string) *apigenRouteMetrics {
+	if m == nil {
+		return nil
+	}
+	rm := m.route(route, method)
+	rm.inFlight.Add(1)
+	return rm
+}
+
+// shed counts a request turned away by the concurrency limit, nil Metrics do nothing
+func (m *Metrics) shed(route, method string) {
+	if m == nil {
+		return
+	}
+	m.route(route, method).shed.Add(1)
+}
+
+// done is deferred by wrappers with the result of start
+func (rm *apigenRouteMetrics) done(sw *apigenStatusWriter, start time.Time) {
+	if rm == nil {
+		return
+	}
+	rm.inFlight.Add(-1)
+	status := sw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if class := status / 100; class > 0 && class < len(rm.statuses) {
+		rm.statuses[class].Add(1)
+	} else {
+		rm.statuses[0].Add(1)
+	}
+	latency := time.Since(start)
+	bucket := sort.SearchFloat64s(apigenLatencyBuckets, latency.Seconds())
+	rm.buckets[bucket].Add(1)
+	rm.count.Add(1)
+	rm.sumNanos.Add(int64(latency))
+}
+
+// ServeHTTP writes the metrics in Prometheus text exposition format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.RLock()
+	keys := make([]apigenMetricsKey, 0, len(m.routes))
+	for key := range m.routes {
+		keys = append(keys, key)
+	}
+	m.mu.RUnlock()
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		return keys[i].method < keys[j].method
+	})
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	statusClasses := []string{"other", "1xx", "2xx", "3xx", "4xx", "5xx"}
+
+	fmt.Fprintf(w, "# HELP apigen_requests_total Requests by route, method and status class.\n")
+	fmt.Fprintf(w, "# TYPE apigen_requests_total counter\n")
+	for _, key := range keys {
+		rm := m.route(key.route, key.method)
+		for class := range rm.statuses {
+			if n := rm.statuses[class].Load(); n > 0 {
+				fmt.Fprintf(w, "apigen_requests_total{%s,status=%q} %d\n", key.labels(), statusClasses[class], n)
+			}
+		}
+	}
+	fmt.Fprintf(w, "# HELP apigen_request_duration_seconds Request latency by route and method.\n")
+	fmt.Fprintf(w, "# TYPE apigen_request_duration_seconds histogram\n")
+	for _, key := range keys {
+		rm := m.route(key.route, key.method)
+		cumulative := uint64(0)
+		for i := range rm.buckets {
+			cumulative += rm.buckets[i].Load()
+			le := "+Inf"
+			if i < len(apigenLatencyBuckets) {
+				le = strconv.FormatFloat(apigenLatencyBuckets[i], 'g', -1, 64)
+			}
+			fmt.Fprintf(w, "apigen_request_duration_seconds_bucket{%s,le=%q} %d\n", key.labels(), le, cumulative)
+		}
+		fmt.Fprintf(w, "apigen_request_duration_seconds_sum{%s} %g\n", key.labels(), time.Duration(rm.sumNanos.Load()).Seconds())
+		fmt.Fprintf(w, "apigen_request_duration_seconds_count{%s} %d\n", key.labels(), rm.count.Load())
+	}
+	fmt.Fprintf(w, "# HELP apigen_requests_in_flight Requests being served by route and method.\n")
+	fmt.Fprintf(w, "# TYPE apigen_requests_in_flight gauge\n")
+	for _, key := range keys {
+		fmt.Fprintf(w, "apigen_requests_in_flight{%s} %d\n", key.labels(), m.route(key.route, key.method).inFlight.Load())
+	}
+	fmt.Fprintf(w, "# HELP apigen_requests_shed_total Requests turned away by the concurrency limit by route and method.\n")
+	fmt.Fprintf(w, "# TYPE apigen_requests_shed_total counter\n")
+	for _, key := range keys {
+		if n := m.route(key.route, key.method).shed.Load(); n > 0 {
+			fmt.Fprintf(w, "apigen_requests_shed_total{%s} %d\n", key.labels(), n)
+		}
+	}
+}
+
+var apigenLabelEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+func (key apigenMetricsKey) labels() string {
+	return "route=\"" + apigenLabelEscaper.Replace(key.route) + "\",method=\"" + apigenLabelEscaper.Replace(key.method) + "\""
+}
+
+// SpanContext is the W3C trace context of a span
+type SpanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Flags      byte
+	TraceState string
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceParent is sc as the traceparent header
+func (sc SpanContext) TraceParent() string {
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// ParseTraceParent reads traceparent and tracestate headers, ok is false if traceparent is bad
+func ParseTraceParent(traceParent, traceState string) (sc SpanContext, ok bool) {
+	parts := strings.Split(traceParent, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || parts[0] == "00" && len(parts) != 4 ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return SpanContext{}, false
+	}
+	sc.Flags = flags[0]
+	sc.TraceState = traceState
+	return sc, sc.IsValid()
+}
+
+// Span is a started span of a Tracer
+type Span interface {
+	SpanContext() SpanContext
+	SetAttribute(key string, value any)
+	RecordError(err error)
+	SetStatus(status int) // HTTP status of the response
+	End()
+}
+
+// Tracer starts spans, parent is invalid when the request has no traceparent
+type Tracer interface {
+	Start(ctx context.Context, name string, parent SpanContext) Span
+}
+
+type apigenSpanKey struct{}
+
+// ContextWithSpan puts span into ctx
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, apigenSpanKey{}, span)
+}
+
+// SpanFromContext returns the span of the request, methods of API types get it in ctx.
+// It's a no-op span if there is none
+func SpanFromContext(ctx context.Context) Span {
+	if span, ok := ctx.Value(apigenSpanKey{}).(Span); ok {
+		return span
+	}
+	return apigenNoopSpan{}
+}
+
+func (cfg *HandlerConfig) startSpan(r *http.Request, name, route string) (*http.Request, Span) {
+	parent, _ := ParseTraceParent(r.Header.Get("traceparent"), r.Header.Get("tracestate"))
+	span := cfg.Tracer.Start(r.Context(), name, parent)
+	span.SetAttribute("http.route", route)
+	span.SetAttribute("http.method", r.Method)
+	return r.WithContext(ContextWithSpan(r.Context(), span)), span
+}
+
+// apigenEndSpan is deferred by wrappers, errors of validation, auth and methods
+// and ApiError statuses get to the span
+func apigenEndSpan(span Span, sw *apigenStatusWriter) {
+	status := sw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if sw.err != nil {
+		span.RecordError(sw.err)
+	}
+	span.SetStatus(status)
+	span.End()
+}
+
+// NoopTracer starts spans that do nothing
+type NoopTracer struct{}
+
+func (NoopTracer) Start(ctx context.Context, name string, parent SpanContext) Span {
+	return apigenNoopSpan{parent}
+}
+
+type apigenNoopSpan struct {
+	sc SpanContext
+}
+
+func (span apigenNoopSpan) SpanContext() SpanContext      { return span.sc }
+func (apigenNoopSpan) SetAttribute(key string, value any) {}
+func (apigenNoopSpan) RecordError(err error)              {}
+func (apigenNoopSpan) SetStatus(status int)               {}
+func (apigenNoopSpan) End()                               {}
+
+// RecordingTracer keeps spans in memory, for tests
+type RecordingTracer struct {
+	mu    sync.Mutex
+	spans []*RecordedSpan
+}
+
+// RecordedSpan is a span of RecordingTracer
+type RecordedSpan struct {
+	tracer     *RecordingTracer
+	Name       string
+	Context    SpanContext
+	Parent     SpanContext
+	Attributes map[string]any
+	Errors     []error
+	Status     int
+	Ended      bool
+}
+
+// Start continues the trace of parent or starts a new one
+func (t *RecordingTracer) Start(ctx context.Context, name string, parent SpanContext) Span {
+	span := &RecordedSpan{tracer: t, Name: name, Parent: parent, Attributes: map[string]any{}}
+	span.Context.TraceID = parent.TraceID
+	if !parent.IsValid() {
+		rand.Read(span.Context.TraceID[:])
+	}
+	rand.Read(span.Context.SpanID[:])
+	span.Context.Flags = parent.Flags
+	span.Context.TraceState = parent.TraceState
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+	return span
+}
+
+// Spans returns copies of all started spans
+func (t *RecordingTracer) Spans() []RecordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	spans := make([]RecordedSpan, 0, len(t.spans))
+	for _, span := range t.spans {
+		spans = append(spans, *span)
+	}
+	return spans
+}
+
+func (span *RecordedSpan) SpanContext() SpanContext {
+	return span.Context
+}
+
+func (span *RecordedSpan) SetAttribute(key string, value any) {
+	span.tracer.mu.Lock()
+	span.Attributes[key] = value
+	span.tracer.mu.Unlock()
+}
+
+func (span *RecordedSpan) RecordError(err error) {
+	span.tracer.mu.Lock()
+	span.Errors = append(span.Errors, err)
+	span.tracer.mu.Unlock()
+}
+
+func (span *RecordedSpan) SetStatus(status int) {
+	span.tracer.mu.Lock()
+	span.Status = status
+	span.tracer.mu.Unlock()
+}
+
+func (span *RecordedSpan) End() {
+	span.tracer.mu.Lock()
+	span.Ended = true
+	span.tracer.mu.Unlock()
+}
+
+// RateLimitStore keeps token buckets of rate limits, a shared store may be plugged in with WithRateLimitStore.
+// Allow takes a token from the bucket of key or tells when the next one comes
+type RateLimitStore interface {
+	Allow(key string, rps float64, burst int, now time.Time) (ok bool, retryAfter time.Duration)
+}
+
+const (
+	apigenRateLimitShards = 32
+	// DefaultRateLimitKeys is how many clients NewMemoryRateLimitStore keeps buckets of
+	DefaultRateLimitKeys = 128 << 10
+)
+
+// MemoryRateLimitStore keeps token buckets in memory of the process,
+// sharded by key so clients don't wait for each other. Every shard keeps
+// a bounded number of buckets, the least recently used one is dropped for a new key
+type MemoryRateLimitStore struct {
+	shards   [apigenRateLimitShards]apigenRateLimitShard
+	perShard int
+}
+
+type apigenRateLimitShard struct {
+	mu      sync.Mutex
+	buckets map[string]*list.Element // of *apigenTokenBucket
+	lru     list.List                // most recently used first
+}
+
+type apigenTokenBucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return NewMemoryRateLimitStoreSize(DefaultRateLimitKeys)
+}
+
+// NewMemoryRateLimitStoreSize makes a store keeping buckets of about maxKeys clients
+func NewMemoryRateLimitStoreSize(maxKeys int) *MemoryRateLimitStore {
+	store := &MemoryRateLimitStore{perShard: (maxKeys + apigenRateLimitShards - 1) / apigenRateLimitShards}
+	if store.perShard < 1 {
+		store.perShard = 1
+	}
+	for i := range store.shards {
+		store.shards[i].buckets = map[string]*list.Element{}
+	}
+	return store
+}
+
+// Len is the number of kept buckets
+func (store *MemoryRateLimitStore) Len() int {
+	n := 0
+	for i := range store.shards {
+		store.shards[i].mu.Lock()
+		n += len(store.shards[i].buckets)
+		store.shards[i].mu.Unlock()
+	}
+	return n
+}
+
+func (store *MemoryRateLimitStore) Allow(key string, rps float64, burst int, now time.Time) (bool, time.Duration) {
+	// FNV-1a
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	shard := &store.shards[hash%apigenRateLimitShards]
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	var bucket *apigenTokenBucket
+	if elem, ok := shard.buckets[key]; ok {
+		shard.lru.MoveToFront(elem)
+		bucket = elem.Value.(*apigenTokenBucket)
+	} else {
+		if len(shard.buckets) >= store.perShard {
+			oldest := shard.lru.Back()
+			shard.lru.Remove(oldest)
+			delete(shard.buckets, oldest.Value.(*apigenTokenBucket).key)
+		}
+		bucket = &apigenTokenBucket{key: key, tokens: float64(burst), last: now}
+		shard.buckets[key] = shard.lru.PushFront(bucket)
+	}
+	if now.After(bucket.last) {
+		bucket.tokens += now.Sub(bucket.last).Seconds() * rps
+		if bucket.tokens > float64(burst) {
+			bucket.tokens = float64(burst)
+		}
+		bucket.last = now
+	}
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / rps * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// rateLimited answers 429 with Retry-After in whole seconds
+func (cfg *HandlerConfig) rateLimited(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	seconds := int64((retryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	cfg.writeError(w, r, http.StatusTooManyRequests, errors.New("rate limit exceeded"))
+}
+
+// apigenClientIP is the host of RemoteAddr, put the address of the client there behind proxies
+func apigenClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// apigenSecretKey hashes credentials and API keys, so rate limit stores never keep them
+func apigenSecretKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:16])
+}
+
+// CORSPolicy is what browsers may do cross-origin, for every method with WithCORS
+// or for one method with "cors" of apigen:api
+type CORSPolicy struct {
+	AllowOrigins     []string // "*" allows any origin
+	AllowMethods     []string // the method of the annotation by default
+	AllowHeaders     []string // "*" allows whatever the preflight asks for
+	ExposeHeaders    []string
+	AllowCredentials bool
+	MaxAge           int // seconds browsers may cache preflights, 0 leaves it to them
+}
+
+// allowOrigin tells if origin may make requests, "*" never allows credentialed ones
+func (policy *CORSPolicy) allowOrigin(origin string) bool {
+	for _, allowed := range policy.AllowOrigins {
+		if allowed == "*" && !policy.AllowCredentials || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+func apigenIsPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Origin") != "" && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// apigenPreflightMethod is the method a CORS preflight asks for, r.Method for other requests,
+// routes dispatch by it so preflights get to the wrapper of the method
+func apigenPreflightMethod(r *http.Request) string {
+	if apigenIsPreflight(r) {
+		return r.Header.Get("Access-Control-Request-Method")
+	}
+	return r.Method
+}
+
+// handleCORS decorates responses of cross-origin requests with policy (CORS of cfg if nil)
+// and answers preflights, true means the request is answered.
+// method is the one of the annotation, "" if any
+func (cfg *HandlerConfig) handleCORS(w http.ResponseWriter, r *http.Request, policy *CORSPolicy, method string) bool {
+	if policy == nil {
+		policy = cfg.CORS
+	}
+	origin := r.Header.Get("Origin")
+	if policy == nil || origin == "" {
+		return false
+	}
+	header := w.Header()
+	header.Add("Vary", "Origin")
+	allowed := policy.allowOrigin(origin)
+	if allowed {
+		if policy.AllowCredentials || !apigenContains(policy.AllowOrigins, "*") {
+			header.Set("Access-Control-Allow-Origin", origin)
+		} else {
+			header.Set("Access-Control-Allow-Origin", "*")
+		}
+		if policy.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+	}
+	if !apigenIsPreflight(r) {
+		if allowed && len(policy.ExposeHeaders) > 0 {
+			header.Set("Access-Control-Expose-Headers", strings.Join(policy.ExposeHeaders, ", "))
+		}
+		return false
+	}
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+	if allowed {
+		methods := policy.AllowMethods
+		if len(methods) == 0 && method != "" {
+			methods = []string{method}
+		} else if len(methods) == 0 {
+			methods = []string{r.Header.Get("Access-Control-Request-Method")}
+		}
+		header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		if apigenContains(policy.AllowHeaders, "*") {
+			if asked := r.Header.Get("Access-Control-Request-Headers"); asked != "" {
+				header.Set("Access-Control-Allow-Headers", asked)
+			}
+		} else if len(policy.AllowHeaders) > 0 {
+			header.Set("Access-Control-Allow-Headers", strings.Join(policy.AllowHeaders, ", "))
+		}
+		if policy.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(policy.MaxAge))
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+func apigenContains(slice []string, str string) bool {
+	for _, have := range slice {
+		if have == str {
+			return true
+		}
+	}
+	return false
+}
+
+// SignatureSecretProvider must be implemented by API types with "signature" methods,
+// method is the name of the Go method being called
+type SignatureSecretProvider interface {
+	SignatureSecret(r *http.Request, method string) ([]byte, error)
+}
+
+// apigenFileRules are apivalidator rules of a file field
+type apigenFileRules struct {
+	name        string // for errors
+	required    bool
+	maxCount    int
+	maxSize     int64
+	maxSizeText string
+	types       []string // "image/*" allows any image
+}
+
+// apigenFormFiles returns files of the multipart form under key checked by rules,
+// content types are sniffed from the first 512 bytes, not taken from the client
+func apigenFormFiles(r *http.Request, key string, rules apigenFileRules) ([]*multipart.FileHeader, error) {
+	var files []*multipart.FileHeader
+	if r.MultipartForm != nil {
+		files = r.MultipartForm.File[key]
+	}
+	if rules.required && len(files) == 0 {
+		return nil, errors.New(rules.name + " must me not empty")
+	}
+	if rules.maxCount > 0 && len(files) > rules.maxCount {
+		return nil, errors.New(rules.name + " must have at most " + strconv.Itoa(rules.maxCount) + " files")
+	}
+	for _, file := range files {
+		if rules.maxSize > 0 && file.Size > rules.maxSize {
+			return nil, errors.New(rules.name + " must be at most " + rules.maxSizeText)
+		}
+		if len(rules.types) == 0 {
+			continue
+		}
+		contentType, err := apigenSniffContentType(file)
+		if err != nil {
+			return nil, errors.New("cant read " + rules.name)
+		}
+		allowed := false
+		for _, want := range rules.types {
+			if want == contentType || strings.HasSuffix(want, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(want, "*")) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, errors.New(rules.name + " must be one of [" + strings.Join(rules.types, ", ") + "]")
+		}
+	}
+	return files, nil
+}
+
+// apigenSniffContentType is http.DetectContentType of the file without parameters
+func apigenSniffContentType(file *multipart.FileHeader) (string, error) {
+	f, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	contentType, _, _ := strings.Cut(http.DetectContentType(head[:n]), ";")
+	return contentType, nil
+}
+
+// apigenFirstFile is the file of a single file field, nil if there is none
+func apigenFirstFile(files []*multipart.FileHeader) *multipart.FileHeader {
+	if len(files) == 0 {
+		return nil
+	}
+	return files[0]
+}
+
+// apigenConcurrencyLimit is a semaphore of "max_concurrency" methods, every config
+// has its own for each method so floods of one don't starve others
+type apigenConcurrencyLimit chan struct{}
+
+// acquire takes a slot, waiting for it up to wait, false means the call is shed
+func (limit apigenConcurrencyLimit) acquire(ctx context.Context, wait time.Duration) bool {
+	select {
+	case limit <- struct{}{}:
+		return true
+	default:
+	}
+	if wait <= 0 {
+		return false
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case limit <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (limit apigenConcurrencyLimit) release() {
+	<-limit
+}
+
+// apigenMaxPathParams is how many {name} segments a route can have
+const apigenMaxPathParams = 8
+
+// apigenRouteNode is a node of the precomputed segment tree of routes,
+// route numbers start from 1, 0 means there is no route
+type apigenRouteNode struct {
+	static   map[string]*apigenRouteNode // exact segments, take priority
+	param    *apigenRouteNode            // {name} segment
+	route    int                         // route ending at this node
+	catchAll int                         // {name...} route taking the rest of the path
+}
+
+// match finds the route for path without the leading slash,
+// values of {name} segments are put to values starting from n
+func (node *apigenRouteNode) match(path string, values *[apigenMaxPathParams]string, n int) int {
+	segment, rest, last := path, "", true
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		segment, rest, last = path[:i], path[i+1:], false
+	}
+	if child, ok := node.static[segment]; ok {
+		if last && child.route != 0 {
+			return child.route
+		}
+		if !last {
+			if route := child.match(rest, values, n); route != 0 {
+				return route
+			}
+		}
+	}
+	if node.param != nil && segment != "" {
+		values[n] = segment
+		if last && node.param.route != 0 {
+			return node.param.route
+		}
+		if !last {
+			if route := node.param.match(rest, values, n+1); route != 0 {
+				return route
+			}
+		}
+	}
+	if node.catchAll != 0 {
+		values[n] = path
+		return node.catchAll
+	}
+	return 0
+}
+
+// apigenRouteRequest matches the request path against the tree. Paths that are not clean
+// are redirected to the cleaned ones, unknown paths are redirected to the same path
+// with or without the trailing slash if that one exists. handled means that
+// the redirect is already written
+func apigenRouteRequest(tree *apigenRouteNode, w http.ResponseWriter, r *http.Request, values *[apigenMaxPathParams]string) (route int, handled bool) {
+	reqPath := r.URL.Path
+	if reqPath == "" || reqPath[0] != '/' {
+		return 0, false
+	}
+	cleaned := path.Clean(reqPath)
+	if reqPath[len(reqPath)-1] == '/' && cleaned != "/" {
+		if reqPath[:len(reqPath)-1] != cleaned {
+			apigenRedirectPath(w, r, cleaned+"/")
+			return 0, true
+		}
+	} else if reqPath != cleaned {
+		apigenRedirectPath(w, r, cleaned)
+		return 0, true
+	}
+	if route = tree.match(reqPath[1:], values, 0); route != 0 || reqPath == "/" {
+		return route, false
+	}
+	other := reqPath + "/"
+	if reqPath[len(reqPath)-1] == '/' {
+		other = reqPath[:len(reqPath)-1]
+	}
+	var otherValues [apigenMaxPathParams]string
+	if tree.match(other[1:], &otherValues, 0) != 0 {
+		apigenRedirectPath(w, r, other)
+		return 0, true
+	}
+	return 0, false
+}
+
+func apigenRedirectPath(w http.ResponseWriter, r *http.Request, to string) {
+	code := http.StatusPermanentRedirect
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		code = http.StatusMovedPermanently
+	}
+	target := *r.URL
+	target.Path = to
+	target.RawPath = ""
+	http.Redirect(w, r, target.String(), code)
+}
+
+type apigenPathParamsKey struct{}
+
+type apigenPathParams struct {
+	names  []string
+	values [apigenMaxPathParams]string
+}
+
+func apigenWithPathParams(r *http.Request, names []string, values *[apigenMaxPathParams]string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), apigenPathParamsKey{}, &apigenPathParams{names, *values}))
+}
+
+// WithPathParams gives values of {name} segments to handlers of Routes()
+// when the path is matched by another router
+func WithPathParams(r *http.Request, params map[string]string) *http.Request {
+	names := make([]string, 0, len(params))
+	var values [apigenMaxPathParams]string
+	for name, value := range params {
+		if len(names) == apigenMaxPathParams {
+			break
+		}
+		values[len(names)] = value
+		names = append(names, name)
+	}
+	return apigenWithPathParams(r, names, &values)
+}
+
+// PathParam returns the value of {name} segment of the matched route
+func PathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(apigenPathParamsKey{}).(*apigenPathParams)
+	if params == nil {
+		return ""
+	}
+	for i, have := range params.names {
+		if have == name {
+			return params.values[i]
+		}
+	}
+	return ""
+}
+
+// ...
+// generated for type: MyApi
+// ...
+
+// MyApiService is what generated handlers need from MyApi
+type MyApiService interface {
+	Profile(ctx context.Context, in ProfileParams) (*User, error)
+	Create(ctx context.Context, in CreateParams) (*NewUser, error)
+}
+
+var _ MyApiService = (*MyApi)(nil)
+
+// middleware chain and concurrency limit of MyApi.Profile
+var apigenChainMyApiProfile = &apigenChainSpec{
+	service: "MyApi",
+	names:   nil,
+	handler: func(cfg *HandlerConfig) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Context().Value(apigenNodeKey{}).(*MyApi).handleProfile(cfg, w, r)
+		})
+	},
+}
+
+// main.methodOptions{URL:"/user/profile", Auth:false, AuthScheme:"", Method:"", Signature:main.signatureOptions{Header:"", Algo:"", TimestampHeader:"", Window:0}, Middleware:[]string(nil), RateLimit:main.rateLimitOptions{RPS:0, Burst:0, Key:""}, Timeout:0, MaxConcurrency:0, QueueWait:0, CORS:main.corsOptions{Origins:[]string(nil), Methods:[]string(nil), Headers:[]string(nil), ExposeHeaders:[]string(nil), Credentials:false, MaxAge:0}, MaxBody:0}
+// [Wrapper for MyApi] method: Profile
+func (node *MyApi) wrapperProfile(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	sw := &apigenStatusWriter{ResponseWriter: w}
+	w = sw
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	defer cfg.logAccess(sw, r, "/user/profile", "Profile", time.Now())
+	defer cfg.Metrics.start("/user/profile", "Profile").done(sw, time.Now())
+	if cfg.Tracer != nil {
+		var span Span
+		r, span = cfg.startSpan(r, "MyApi.Profile", "/user/profile")
+		defer apigenEndSpan(span, sw)
+	}
+	if !cfg.DisableRecovery {
+		defer cfg.recoverPanic(w, r, "Profile")
+	}
+
+	// CORS, preflights are answered here
+	if cfg.handleCORS(w, r, nil, "") {
+		return
+	}
+
+	// Body limit, bodies known to be too large are rejected before reading
+	if bodyLimit := cfg.MaxBodySize; bodyLimit > 0 {
+		if r.ContentLength > bodyLimit {
+			cfg.writeError(w, r, http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+	}
+
+	// Middlewares run after the checks, before binding params
+	cfg.chain(apigenChainMyApiProfile).handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apigenNodeKey{}, node)))
+}
+
+// [Handler for MyApi] method: Profile, binds params and calls the method
+func (node *MyApi) handleProfile(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	// validation ProfileParams
+	values, ok := cfg.bindValues(w, r, []string{"login"})
+	if !ok {
+		return
+	}
+	if r.MultipartForm != nil {
+		// net/http removes temp files of the request it made, not of r made by WithContext
+		defer r.MultipartForm.RemoveAll()
+	}
+	paramLogin := values.Get("login")
+	// tplRequired
+	if paramLogin == "" {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("login must me not empty"))
+		return
+	}
+
+	params := ProfileParams{
+		Login: paramLogin,
+	}
+	ctx, cancel := cfg.methodContext(r, 0)
+	defer cancel()
+	response, err := node.Profile(ctx, params)
+	if err != nil {
+		switch err.(type) {
+		case ApiError:
+			cfg.writeError(w, r, err.(ApiError).HTTPStatus, err)
+		default:
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+				cfg.writeError(w, r, http.StatusGatewayTimeout, errors.New("timeout"))
+				return
+			}
+			cfg.Logger.Error("method failed", "method", "Profile", "request_id", RequestIDFromContext(ctx), "error", err)
+			cfg.writeError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	data, _ := json.Marshal(apigenResValue{"error": "", "response": response})
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(data))
+}
+
+// middleware chain and concurrency limit of MyApi.Create
+var apigenChainMyApiCreate = &apigenChainSpec{
+	service: "MyApi",
+	names:   nil,
+	handler: func(cfg *HandlerConfig) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Context().Value(apigenNodeKey{}).(*MyApi).handleCreate(cfg, w, r)
+		})
+	},
+}
+
+// main.methodOptions{URL:"/user/create", Auth:true, AuthScheme:"header", Method:"POST", Signature:main.signatureOptions{Header:"", Algo:"", TimestampHeader:"", Window:0}, Middleware:[]string(nil), RateLimit:main.rateLimitOptions{RPS:0, Burst:0, Key:""}, Timeout:0, MaxConcurrency:0, QueueWait:0, CORS:main.corsOptions{Origins:[]string(nil), Methods:[]string(nil), Headers:[]string(nil), ExposeHeaders:[]string(nil), Credentials:false, MaxAge:0}, MaxBody:0}
+// [Wrapper for MyApi] method: Create
+func (node *MyApi) wrapperCreate(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	sw := &apigenStatusWriter{ResponseWriter: w}
+	w = sw
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	defer cfg.logAccess(sw, r, "/user/create", "Create", time.Now())
+	defer cfg.Metrics.start("/user/create", "Create").done(sw, time.Now())
+	if cfg.Tracer != nil {
+		var span Span
+		r, span = cfg.startSpan(r, "MyApi.Create", "/user/create")
+		defer apigenEndSpan(span, sw)
+	}
+	if !cfg.DisableRecovery {
+		defer cfg.recoverPanic(w, r, "Create")
+	}
+
+	// CORS, preflights are answered here
+	if cfg.handleCORS(w, r, nil, "POST") {
+		return
+	}
+
+	// Body limit, bodies known to be too large are rejected before reading
+	if bodyLimit := cfg.MaxBodySize; bodyLimit > 0 {
+		if r.ContentLength > bodyLimit {
+			cfg.writeError(w, r, http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+	}
+
+	// Authorization checker (header)
+	authCred := AuthCredential{Scheme: "header", Token: r.Header.Get("X-Auth")}
+	if !cfg.AuthVerifier(r, authCred) {
+		cfg.writeError(w, r, http.StatusForbidden, errors.New("unauthorized"))
+		return
+	}
+
+	// Method checker
+	if r.Method != http.MethodPost {
+		cfg.writeError(w, r, http.StatusNotAcceptable, errors.New("bad method"))
+		return
+	}
+
+	// Middlewares run after the checks, before binding params
+	cfg.chain(apigenChainMyApiCreate).handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apigenNodeKey{}, node)))
+}
+
+// [Handler for MyApi] method: Create, binds params and calls the method
+func (node *MyApi) handleCreate(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	// validation CreateParams
+	values, ok := cfg.bindValues(w, r, []string{"login", "full_name", "status", "age"})
+	if !ok {
+		return
+	}
+	if r.MultipartForm != nil {
+		// net/http removes temp files of the request it made, not of r made by WithContext
+		defer r.MultipartForm.RemoveAll()
+	}
+	paramLogin := values.Get("login")
+	// tplRequired
+	if paramLogin == "" {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("login must me not empty"))
+		return
+	}
+
+	// tplMin
+	if len([]rune(paramLogin)) < 10 {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("login len must be >= 10"))
+		return
+	}
+
+	paramName := values.Get("full_name")
+	paramStatus := values.Get("status")
+	// tplDefault
+	if paramStatus == "" {
+		paramStatus = "user"
+	}
+
+	// tplEnum
+	enumFlag := false
+	if paramStatus == "user" {
+		enumFlag = true
+	}
+	if paramStatus == "moderator" {
+		enumFlag = true
+	}
+	if paramStatus == "admin" {
+		enumFlag = true
+	}
+	if !enumFlag {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("status must be one of [user, moderator, admin]"))
+		return
+	}
+
+	paramAge := values.Get("age")
+	// tplMin
+	paramAgeIntMin, err := strconv.Atoi(paramAge)
+	if err != nil {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("age must be int"))
+		return
+	}
+	if paramAgeIntMin < 0 {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("age must be >= 0"))
+		return
+	}
+
+	// tplMax
+	paramAgeIntMax, err := strconv.Atoi(paramAge)
+	if err != nil {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("age must be int"))
+		return
+	}
+	if paramAgeIntMax > 128 {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("age must be <= 128"))
+		return
+	}
+
+	paramAgeInt, _ := strconv.Atoi(paramAge)
+	params := CreateParams{
+		Login:  paramLogin,
+		Name:   paramName,
+		Status: paramStatus,
+		Age:    paramAgeInt,
+	}
+	ctx, cancel := cfg.methodContext(r, 0)
+	defer cancel()
+	response, err := node.Create(ctx, params)
+	if err != nil {
+		switch err.(type) {
+		case ApiError:
+			cfg.writeError(w, r, err.(ApiError).HTTPStatus, err)
+		default:
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+				cfg.writeError(w, r, http.StatusGatewayTimeout, errors.New("timeout"))
+				return
+			}
+			cfg.Logger.Error("method failed", "method", "Create", "request_id", RequestIDFromContext(ctx), "error", err)
+			cfg.writeError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	data, _ := json.Marshal(apigenResValue{"error": "", "response": response})
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(data))
+}
+
+// middleware chains of MyApi built by constructors
+var apigenChainsMyApi = []*apigenChainSpec{apigenChainMyApiProfile, apigenChainMyApiCreate}
+
+// routes of MyApi
+var apigenRoutesMyApi = &apigenRouteNode{static: map[string]*apigenRouteNode{
+	"user": {static: map[string]*apigenRouteNode{
+		"create":  {route: 2},
+		"profile": {route: 1},
+	}},
+}}
+
+// ServeHTTP for MyApi
+func (node *MyApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cfg := &DefaultHandlerConfig
+	// before routing, so redirects, 404 and 406 carry the ID too
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	var pathValues [apigenMaxPathParams]string
+	route, handled := apigenRouteRequest(apigenRoutesMyApi, w, r, &pathValues)
+	if handled {
+		return
+	}
+	switch route {
+	case 1: // /user/profile
+		node.wrapperProfile(cfg, w, r)
+	case 2: // /user/create
+		node.wrapperCreate(cfg, w, r)
+	default:
+		if cfg.NotFound != nil {
+			cfg.NotFound.ServeHTTP(w, r)
+			return
+		}
+		cfg.writeError(w, r, http.StatusNotFound, errors.New("unknown method"))
+	}
+}
+
+// Routes of MyApi for any router
+func (node *MyApi) Routes() []Route {
+	cfg := &DefaultHandlerConfig
+	return []Route{
+		{
+			Method:      "",
+			Pattern:     "/user/profile",
+			Handler:     func(w http.ResponseWriter, r *http.Request) { node.wrapperProfile(cfg, w, r) },
+			Service:     "MyApi",
+			Name:        "Profile",
+			Auth:        false,
+			AuthScheme:  "",
+			ParamStruct: "ProfileParams",
+			Params: []RouteParam{
+				{Name: "login", In: ""},
+			},
+		},
+		{
+			Method:      "POST",
+			Pattern:     "/user/create",
+			Handler:     func(w http.ResponseWriter, r *http.Request) { node.wrapperCreate(cfg, w, r) },
+			Service:     "MyApi",
+			Name:        "Create",
+			Auth:        true,
+			AuthScheme:  "header",
+			ParamStruct: "CreateParams",
+			Params: []RouteParam{
+				{Name: "login", In: ""},
+				{Name: "full_name", In: ""},
+				{Name: "status", In: ""},
+				{Name: "age", In: ""},
+			},
+		},
+	}
+}
+
+// ...
+// generated for type: OtherApi
+// ...
+
+// OtherApiService is what generated handlers need from OtherApi
+type OtherApiService interface {
+	Create(ctx context.Context, in OtherCreateParams) (*OtherUser, error)
+}
+
+var _ OtherApiService = (*OtherApi)(nil)
+
+// middleware chain and concurrency limit of OtherApi.Create
+var apigenChainOtherApiCreate = &apigenChainSpec{
+	service: "OtherApi",
+	names:   nil,
+	handler: func(cfg *HandlerConfig) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Context().Value(apigenNodeKey{}).(*OtherApi).handleCreate(cfg, w, r)
+		})
+	},
+}
+
+// main.methodOptions{URL:"/user/create", Auth:true, AuthScheme:"header", Method:"POST", Signature:main.signatureOptions{Header:"", Algo:"", TimestampHeader:"", Window:0}, Middleware:[]string(nil), RateLimit:main.rateLimitOptions{RPS:0, Burst:0, Key:""}, Timeout:0, MaxConcurrency:0, QueueWait:0, CORS:main.corsOptions{Origins:[]string(nil), Methods:[]string(nil), Headers:[]string(nil), ExposeHeaders:[]string(nil), Credentials:false, MaxAge:0}, MaxBody:0}
+// [Wrapper for OtherApi] method: Create
+func (node *OtherApi) wrapperCreate(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	sw := &apigenStatusWriter{ResponseWriter: w}
+	w = sw
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	defer cfg.logAccess(sw, r, "/user/create", "Create", time.Now())
+	defer cfg.Metrics.start("/user/create", "Create").done(sw, time.Now())
+	if cfg.Tracer != nil {
+		var span Span
+		r, span = cfg.startSpan(r, "OtherApi.Create", "/user/create")
+		defer apigenEndSpan(span, sw)
+	}
+	if !cfg.DisableRecovery {
+		defer cfg.recoverPanic(w, r, "Create")
+	}
+
+	// CORS, preflights are answered here
+	if cfg.handleCORS(w, r, nil, "POST") {
+		return
+	}
+
+	// Body limit, bodies known to be too large are rejected before reading
+	if bodyLimit := cfg.MaxBodySize; bodyLimit > 0 {
+		if r.ContentLength > bodyLimit {
+			cfg.writeError(w, r, http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+	}
+
+	// Authorization checker (header)
+	authCred := AuthCredential{Scheme: "header", Token: r.Header.Get("X-Auth")}
+	if !cfg.AuthVerifier(r, authCred) {
+		cfg.writeError(w, r, http.StatusForbidden, errors.New("unauthorized"))
+		return
+	}
+
+	// Method checker
+	if r.Method != http.MethodPost {
+		cfg.writeError(w, r, http.StatusNotAcceptable, errors.New("bad method"))
+		return
+	}
+
+	// Middlewares run after the checks, before binding params
+	cfg.chain(apigenChainOtherApiCreate).handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apigenNodeKey{}, node)))
+}
+
+// [Handler for OtherApi] method: Create, binds params and calls the method
+func (node *OtherApi) handleCreate(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	// validation OtherCreateParams
+	values, ok := cfg.bindValues(w, r, []string{"username", "account_name", "class", "level"})
+	if !ok {
+		return
+	}
+	if r.MultipartForm != nil {
+		// net/http removes temp files of the request it made, not of r made by WithContext
+		defer r.MultipartForm.RemoveAll()
+	}
+	paramUsername := values.Get("username")
+	// tplRequired
+	if paramUsername == "" {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("username must me not empty"))
+		return
+	}
+
+	// tplMin
+	if len([]rune(paramUsername)) < 3 {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("username len must be >= 3"))
+		return
+	}
+
+	paramName := values.Get("account_name")
+	paramClass := values.Get("class")
+	// tplDefault
+	if paramClass == "" {
+		paramClass = "warrior"
+	}
+
+	// tplEnum
+	enumFlag := false
+	if paramClass == "warrior" {
+		enumFlag = true
+	}
+	if paramClass == "sorcerer" {
+		enumFlag = true
+	}
+	if paramClass == "rouge" {
+		enumFlag = true
+	}
+	if !enumFlag {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("class must be one of [warrior, sorcerer, rouge]"))
+		return
+	}
+
+	paramLevel := values.Get("level")
+	// tplMin
+	paramLevelIntMin, err := strconv.Atoi(paramLevel)
+	if err != nil {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("level must be int"))
+		return
+	}
+	if paramLevelIntMin < 1 {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("level must be >= 1"))
+		return
+	}
+
+	// tplMax
+	paramLevelIntMax, err := strconv.Atoi(paramLevel)
+	if err != nil {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("level must be int"))
+		return
+	}
+	if paramLevelIntMax > 50 {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("level must be <= 50"))
+		return
+	}
+
+	paramLevelInt, _ := strconv.Atoi(paramLevel)
+	params := OtherCreateParams{
+		Username: paramUsername,
+		Name:     paramName,
+		Class:    paramClass,
+		Level:    paramLevelInt,
+	}
+	ctx, cancel := cfg.methodContext(r, 0)
+	defer cancel()
+	response, err := node.Create(ctx, params)
+	if err != nil {
+		switch err.(type) {
+		case ApiError:
+			cfg.writeError(w, r, err.(ApiError).HTTPStatus, err)
+		default:
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+				cfg.writeError(w, r, http.StatusGatewayTimeout, errors.New("timeout"))
+				return
+			}
+			cfg.Logger.Error("method failed", "method", "Create", "request_id", RequestIDFromContext(ctx), "error", err)
+			cfg.writeError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	data, _ := json.Marshal(apigenResValue{"error": "", "response": response})
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(data))
+}
+
+// middleware chains of OtherApi built by constructors
+var apigenChainsOtherApi = []*apigenChainSpec{apigenChainOtherApiCreate}
+
+// routes of OtherApi
+var apigenRoutesOtherApi = &apigenRouteNode{static: map[string]*apigenRouteNode{
+	"user": {static: map[string]*apigenRouteNode{
+		"create": {route: 1},
+	}},
+}}
+
+// ServeHTTP for OtherApi
+func (node *OtherApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cfg := &DefaultHandlerConfig
+	// before routing, so redirects, 404 and 406 carry the ID too
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	var pathValues [apigenMaxPathParams]string
+	route, handled := apigenRouteRequest(apigenRoutesOtherApi, w, r, &pathValues)
+	if handled {
+		return
+	}
+	switch route {
+	case 1: // /user/create
+		node.wrapperCreate(cfg, w, r)
+	default:
+		if cfg.NotFound != nil {
+			cfg.NotFound.ServeHTTP(w, r)
+			return
+		}
+		cfg.writeError(w, r, http.StatusNotFound, errors.New("unknown method"))
+	}
+}
+
+// Routes of OtherApi for any router
+func (node *OtherApi) Routes() []Route {
+	cfg := &DefaultHandlerConfig
+	return []Route{
+		{
+			Method:      "POST",
+			Pattern:     "/user/create",
+			Handler:     func(w http.ResponseWriter, r *http.Request) { node.wrapperCreate(cfg, w, r) },
+			Service:     "OtherApi",
+			Name:        "Create",
+			Auth:        true,
+			AuthScheme:  "header",
+			ParamStruct: "OtherCreateParams",
+			Params: []RouteParam{
+				{Name: "username", In: ""},
+				{Name: "account_name", In: ""},
+				{Name: "class", In: ""},
+				{Name: "level", In: ""},
+			},
+		},
+	}
+}
+
+// ...
+// generated for type: ShopApi
+// ...
+
+// ShopApiService is what generated handlers need from ShopApi
+type ShopApiService interface {
+	SignatureSecretProvider
+	Public(ctx context.Context, in ItemParams) (*Item, error)
+	Item(ctx context.Context, in ItemParams) (*Item, error)
+	Featured(ctx context.Context, in FeaturedParams) (*Item, error)
+	Download(ctx context.Context, in DownloadParams) (*Item, error)
+	Account(ctx context.Context, in AccountParams) (*Account, error)
+	Balance(ctx context.Context, in AccountParams) (*Account, error)
+	History(ctx context.Context, in AccountParams) (*Account, error)
+	Order(ctx context.Context, in OrderParams) (*Order, error)
+	Search(ctx context.Context, in SearchParams) (*Item, error)
+	Quote(ctx context.Context, in QuoteParams) (*Order, error)
+	Checkout(ctx context.Context, in OrderParams) (*Order, error)
+	AddToCart(ctx context.Context, in CartParams) (*CartItem, error)
+	Photo(ctx context.Context, in PhotoParams) (*Photo, error)
+	Payment(ctx context.Context, in PaymentParams) (*Order, error)
+}
+
+var _ ShopApiService = (*ShopApi)(nil)
+
+// CORS policy of ShopApi.Public
+var apigenCorsShopApiPublic = &CORSPolicy{
+	AllowOrigins: []string{"*"},
+	AllowHeaders: []string{"X-Auth"},
+}
+
+// middleware chain and concurrency limit of ShopApi.Public
+var apigenChainShopApiPublic = &apigenChainSpec{
+	service: "ShopApi",
+	names:   nil,
+	handler: func(cfg *HandlerConfig) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Context().Value(apigenNodeKey{}).(*ShopApi).handlePublic(cfg, w, r)
+		})
+	},
+}
+
+// main.methodOptions{URL:"/shop/public", Auth:false, AuthScheme:"", Method:"GET", Signature:main.signatureOptions{Header:"", Algo:"", TimestampHeader:"", Window:0}, Middleware:[]string(nil), RateLimit:main.rateLimitOptions{RPS:0, Burst:0, Key:""}, Timeout:0, MaxConcurrency:0, QueueWait:0, CORS:main.corsOptions{Origins:[]string{"*"}, Methods:[]string(nil), Headers:[]string{"X-Auth"}, ExposeHeaders:[]string(nil), Credentials:false, MaxAge:0}, MaxBody:0}
+// [Wrapper for ShopApi] method: Public
+func (node *ShopApi) wrapperPublic(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	sw := &apigenStatusWriter{ResponseWriter: w}
+	w = sw
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	defer cfg.logAccess(sw, r, "/shop/public", "Public", time.Now())
+	defer cfg.Metrics.start("/shop/public", "Public").done(sw, time.Now())
+	if cfg.Tracer != nil {
+		var span Span
+		r, span = cfg.startSpan(r, "ShopApi.Public", "/shop/public")
+		defer apigenEndSpan(span, sw)
+	}
+	if !cfg.DisableRecovery {
+		defer cfg.recoverPanic(w, r, "Public")
+	}
+
+	// CORS, preflights are answered here
+	if cfg.handleCORS(w, r, apigenCorsShopApiPublic, "GET") {
+		return
+	}
+
+	// Body limit, bodies known to be too large are rejected before reading
+	if bodyLimit := cfg.MaxBodySize; bodyLimit > 0 {
+		if r.ContentLength > bodyLimit {
+			cfg.writeError(w, r, http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+	}
+
+	// Method checker
+	if r.Method != http.MethodGet {
+		cfg.writeError(w, r, http.StatusNotAcceptable, errors.New("bad method"))
+		return
+	}
+
+	// Middlewares run after the checks, before binding params
+	cfg.chain(apigenChainShopApiPublic).handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apigenNodeKey{}, node)))
+}
+
+// [Handler for ShopApi] method: Public, binds params and calls the method
+func (node *ShopApi) handlePublic(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	// validation ItemParams
+	values, ok := cfg.bindValues(w, r, []string{"id"})
+	if !ok {
+		return
+	}
+	if r.MultipartForm != nil {
+		// net/http removes temp files of the request it made, not of r made by WithContext
+		defer r.MultipartForm.RemoveAll()
+	}
+	paramID := values.Get("id")
+	// tplRequired
+	if paramID == "" {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("id must me not empty"))
+		return
+	}
+
+	params := ItemParams{
+		ID: paramID,
+	}
+	ctx, cancel := cfg.methodContext(r, 0)
+	defer cancel()
+	response, err := node.Public(ctx, params)
+	if err != nil {
+		switch err.(type) {
+		case ApiError:
+			cfg.writeError(w, r, err.(ApiError).HTTPStatus, err)
+		default:
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+				cfg.writeError(w, r, http.StatusGatewayTimeout, errors.New("timeout"))
+				return
+			}
+			cfg.Logger.Error("method failed", "method", "Public", "request_id", RequestIDFromContext(ctx), "error", err)
+			cfg.writeError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	data, _ := json.Marshal(apigenResValue{"error": "", "response": response})
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(data))
+}
+
+// CORS policy of ShopApi.Item
+var apigenCorsShopApiItem = &CORSPolicy{
+	AllowOrigins: []string{"https://shop.example", "https://admin.example"},
+	AllowHeaders: []string{"X-Auth"},
+}
+
+// middleware chain and concurrency limit of ShopApi.Item
+var apigenChainShopApiItem = &apigenChainSpec{
+	service: "ShopApi",
+	names:   nil,
+	handler: func(cfg *HandlerConfig) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Context().Value(apigenNodeKey{}).(*ShopApi).handleItem(cfg, w, r)
+		})
+	},
+}
+
+// main.methodOptions{URL:"/shop/items/{id}", Auth:false, AuthScheme:"", Method:"GET", Signature:main.signatureOptions{Header:"", Algo:"", TimestampHeader:"", Window:0}, Middleware:[]string(nil), RateLimit:main.rateLimitOptions{RPS:0, Burst:0, Key:""}, Timeout:0, MaxConcurrency:0, QueueWait:0, CORS:main.corsOptions{Origins:[]string{"https://shop.example", "https://admin.example"}, Methods:[]string(nil), Headers:[]string{"X-Auth"}, ExposeHeaders:[]string(nil), Credentials:false, MaxAge:0}, MaxBody:0}
+// [Wrapper for ShopApi] method: Item
+func (node *ShopApi) wrapperItem(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	sw := &apigenStatusWriter{ResponseWriter: w}
+	w = sw
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	defer cfg.logAccess(sw, r, "/shop/items/{id}", "Item", time.Now())
+	defer cfg.Metrics.start("/shop/items/{id}", "Item").done(sw, time.Now())
+	if cfg.Tracer != nil {
+		var span Span
+		r, span = cfg.startSpan(r, "ShopApi.Item", "/shop/items/{id}")
+		defer apigenEndSpan(span, sw)
+	}
+	if !cfg.DisableRecovery {
+		defer cfg.recoverPanic(w, r, "Item")
+	}
+
+	// CORS, preflights are answered here
+	if cfg.handleCORS(w, r, apigenCorsShopApiItem, "GET") {
+		return
+	}
+
+	// Body limit, bodies known to be too large are rejected before reading
+	if bodyLimit := cfg.MaxBodySize; bodyLimit > 0 {
+		if r.ContentLength > bodyLimit {
+			cfg.writeError(w, r, http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+	}
+
+	// Method checker
+	if r.Method != http.MethodGet {
+		cfg.writeError(w, r, http.StatusNotAcceptable, errors.New("bad method"))
+		return
+	}
+
+	// Middlewares run after the checks, before binding params
+	cfg.chain(apigenChainShopApiItem).handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apigenNodeKey{}, node)))
+}
+
+// [Handler for ShopApi] method: Item, binds params and calls the method
+func (node *ShopApi) handleItem(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	// validation ItemParams
+	paramID := PathParam(r, "id")
+	// tplRequired
+	if paramID == "" {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("id must me not empty"))
+		return
+	}
+
+	params := ItemParams{
+		ID: paramID,
+	}
+	ctx, cancel := cfg.methodContext(r, 0)
+	defer cancel()
+	response, err := node.Item(ctx, params)
+	if err != nil {
+		switch err.(type) {
+		case ApiError:
+			cfg.writeError(w, r, err.(ApiError).HTTPStatus, err)
+		default:
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+				cfg.writeError(w, r, http.StatusGatewayTimeout, errors.New("timeout"))
+				return
+			}
+			cfg.Logger.Error("method failed", "method", "Item", "request_id", RequestIDFromContext(ctx), "error", err)
+			cfg.writeError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	data, _ := json.Marshal(apigenResValue{"error": "", "response": response})
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(data))
+}
+
+// CORS policy of ShopApi.Featured
+var apigenCorsShopApiFeatured = &CORSPolicy{
+	AllowOrigins: []string{"https://shop.example", "https://admin.example"},
+	AllowHeaders: []string{"X-Auth"},
+}
+
+// middleware chain and concurrency limit of ShopApi.Featured
+var apigenChainShopApiFeatured = &apigenChainSpec{
+	service: "ShopApi",
+	names:   nil,
+	handler: func(cfg *HandlerConfig) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Context().Value(apigenNodeKey{}).(*ShopApi).handleFeatured(cfg, w, r)
+		})
+	},
+}
+
+// main.methodOptions{URL:"/shop/items/featured", Auth:false, AuthScheme:"", Method:"GET", Signature:main.signatureOptions{Header:"", Algo:"", TimestampHeader:"", Window:0}, Middleware:[]string(nil), RateLimit:main.rateLimitOptions{RPS:0, Burst:0, Key:""}, Timeout:0, MaxConcurrency:0, QueueWait:0, CORS:main.corsOptions{Origins:[]string{"https://shop.example", "https://admin.example"}, Methods:[]string(nil), Headers:[]string{"X-Auth"}, ExposeHeaders:[]string(nil), Credentials:false, MaxAge:0}, MaxBody:0}
+// [Wrapper for ShopApi] method: Featured
+func (node *ShopApi) wrapperFeatured(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	sw := &apigenStatusWriter{ResponseWriter: w}
+	w = sw
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	defer cfg.logAccess(sw, r, "/shop/items/featured", "Featured", time.Now())
+	defer cfg.Metrics.start("/shop/items/featured", "Featured").done(sw, time.Now())
+	if cfg.Tracer != nil {
+		var span Span
+		r, span = cfg.startSpan(r, "ShopApi.Featured", "/shop/items/featured")
+		defer apigenEndSpan(span, sw)
+	}
+	if !cfg.DisableRecovery {
+		defer cfg.recoverPanic(w, r, "Featured")
+	}
+
+	// CORS, preflights are answered here
+	if cfg.handleCORS(w, r, apigenCorsShopApiFeatured, "GET") {
+		return
+	}
+
+	// Body limit, bodies known to be too large are rejected before reading
+	if bodyLimit := cfg.MaxBodySize; bodyLimit > 0 {
+		if r.ContentLength > bodyLimit {
+			cfg.writeError(w, r, http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+	}
+
+	// Method checker
+	if r.Method != http.MethodGet {
+		cfg.writeError(w, r, http.StatusNotAcceptable, errors.New("bad method"))
+		return
+	}
+
+	// Middlewares run after the checks, before binding params
+	cfg.chain(apigenChainShopApiFeatured).handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apigenNodeKey{}, node)))
+}
+
+// [Handler for ShopApi] method: Featured, binds params and calls the method
+func (node *ShopApi) handleFeatured(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	// validation FeaturedParams
+	params := FeaturedParams{}
+	ctx, cancel := cfg.methodContext(r, 0)
+	defer cancel()
+	response, err := node.Featured(ctx, params)
+	if err != nil {
+		switch err.(type) {
+		case ApiError:
+			cfg.writeError(w, r, err.(ApiError).HTTPStatus, err)
+		default:
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+				cfg.writeError(w, r, http.StatusGatewayTimeout, errors.New("timeout"))
+				return
+			}
+			cfg.Logger.Error("method failed", "method", "Featured", "request_id", RequestIDFromContext(ctx), "error", err)
+			cfg.writeError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	data, _ := json.Marshal(apigenResValue{"error": "", "response": response})
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(data))
+}
+
+// CORS policy of ShopApi.Download
+var apigenCorsShopApiDownload = &CORSPolicy{
+	AllowOrigins: []string{"https://shop.example", "https://admin.example"},
+	AllowHeaders: []string{"X-Auth"},
+}
+
+// middleware chain and concurrency limit of ShopApi.Download
+var apigenChainShopApiDownload = &apigenChainSpec{
+	service: "ShopApi",
+	names:   nil,
+	handler: func(cfg *HandlerConfig) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Context().Value(apigenNodeKey{}).(*ShopApi).handleDownload(cfg, w, r)
+		})
+	},
+}
+
+// main.methodOptions{URL:"/shop/files/{path...}", Auth:false, AuthScheme:"", Method:"GET", Signature:main.signatureOptions{Header:"", Algo:"", TimestampHeader:"", Window:0}, Middleware:[]string(nil), RateLimit:main.rateLimitOptions{RPS:0, Burst:0, Key:""}, Timeout:0, MaxConcurrency:0, QueueWait:0, CORS:main.corsOptions{Origins:[]string{"https://shop.example", "https://admin.example"}, Methods:[]string(nil), Headers:[]string{"X-Auth"}, ExposeHeaders:[]string(nil), Credentials:false, MaxAge:0}, MaxBody:0}
+// [Wrapper for ShopApi] method: Download
+func (node *ShopApi) wrapperDownload(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	sw := &apigenStatusWriter{ResponseWriter: w}
+	w = sw
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	defer cfg.logAccess(sw, r, "/shop/files/{path...}", "Download", time.Now())
+	defer cfg.Metrics.start("/shop/files/{path...}", "Download").done(sw, time.Now())
+	if cfg.Tracer != nil {
+		var span Span
+		r, span = cfg.startSpan(r, "ShopApi.Download", "/shop/files/{path...}")
+		defer apigenEndSpan(span, sw)
+	}
+	if !cfg.DisableRecovery {
+		defer cfg.recoverPanic(w, r, "Download")
+	}
+
+	// CORS, preflights are answered here
+	if cfg.handleCORS(w, r, apigenCorsShopApiDownload, "GET") {
+		return
+	}
+
+	// Body limit, bodies known to be too large are rejected before reading
+	if bodyLimit := cfg.MaxBodySize; bodyLimit > 0 {
+		if r.ContentLength > bodyLimit {
+			cfg.writeError(w, r, http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+	}
+
+	// Method checker
+	if r.Method != http.MethodGet {
+		cfg.writeError(w, r, http.StatusNotAcceptable, errors.New("bad method"))
+		return
+	}
+
+	// Middlewares run after the checks, before binding params
+	cfg.chain(apigenChainShopApiDownload).handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apigenNodeKey{}, node)))
+}
+
+// [Handler for ShopApi] method: Download, binds params and calls the method
+func (node *ShopApi) handleDownload(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	// validation DownloadParams
+	paramPath := PathParam(r, "path")
+	// tplRequired
+	if paramPath == "" {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("path must me not empty"))
+		return
+	}
+
+	params := DownloadParams{
+		Path: paramPath,
+	}
+	ctx, cancel := cfg.methodContext(r, 0)
+	defer cancel()
+	response, err := node.Download(ctx, params)
+	if err != nil {
+		switch err.(type) {
+		case ApiError:
+			cfg.writeError(w, r, err.(ApiError).HTTPStatus, err)
+		default:
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+				cfg.writeError(w, r, http.StatusGatewayTimeout, errors.New("timeout"))
+				return
+			}
+			cfg.Logger.Error("method failed", "method", "Download", "request_id", RequestIDFromContext(ctx), "error", err)
+			cfg.writeError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	data, _ := json.Marshal(apigenResValue{"error": "", "response": response})
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(data))
+}
+
+// CORS policy of ShopApi.Account
+var apigenCorsShopApiAccount = &CORSPolicy{
+	AllowOrigins: []string{"https://shop.example", "https://admin.example"},
+	AllowHeaders: []string{"X-Auth"},
+}
+
+// middleware chain and concurrency limit of ShopApi.Account
+var apigenChainShopApiAccount = &apigenChainSpec{
+	service: "ShopApi",
+	names:   nil,
+	handler: func(cfg *HandlerConfig) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Context().Value(apigenNodeKey{}).(*ShopApi).handleAccount(cfg, w, r)
+		})
+	},
+}
+
+// main.methodOptions{URL:"/shop/account", Auth:true, AuthScheme:"basic", Method:"GET", Signature:main.signatureOptions{Header:"", Algo:"", TimestampHeader:"", Window:0}, Middleware:[]string(nil), RateLimit:main.rateLimitOptions{RPS:0, Burst:0, Key:""}, Timeout:0, MaxConcurrency:0, QueueWait:0, CORS:main.corsOptions{Origins:[]string{"https://shop.example", "https://admin.example"}, Methods:[]string(nil), Headers:[]string{"X-Auth"}, ExposeHeaders:[]string(nil), Credentials:false, MaxAge:0}, MaxBody:0}
+// [Wrapper for ShopApi] method: Account
+func (node *ShopApi) wrapperAccount(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	sw := &apigenStatusWriter{ResponseWriter: w}
+	w = sw
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	defer cfg.logAccess(sw, r, "/shop/account", "Account", time.Now())
+	defer cfg.Metrics.start("/shop/account", "Account").done(sw, time.Now())
+	if cfg.Tracer != nil {
+		var span Span
+		r, span = cfg.startSpan(r, "ShopApi.Account", "/shop/account")
+		defer apigenEndSpan(span, sw)
+	}
+	if !cfg.DisableRecovery {
+		defer cfg.recoverPanic(w, r, "Account")
+	}
+
+	// CORS, preflights are answered here
+	if cfg.handleCORS(w, r, apigenCorsShopApiAccount, "GET") {
+		return
+	}
+
+	// Body limit, bodies known to be too large are rejected before reading
+	if bodyLimit := cfg.MaxBodySize; bodyLimit > 0 {
+		if r.ContentLength > bodyLimit {
+			cfg.writeError(w, r, http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+	}
+
+	// Authorization checker (basic)
+	authUser, authPassword, _ := r.BasicAuth()
+	authCred := AuthCredential{Scheme: "basic", User: authUser, Password: authPassword}
+	if !cfg.AuthVerifier(r, authCred) {
+		cfg.writeError(w, r, http.StatusForbidden, errors.New("unauthorized"))
+		return
+	}
+
+	// Method checker
+	if r.Method != http.MethodGet {
+		cfg.writeError(w, r, http.StatusNotAcceptable, errors.New("bad method"))
+		return
+	}
+
+	// Middlewares run after the checks, before binding params
+	cfg.chain(apigenChainShopApiAccount).handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apigenNodeKey{}, node)))
+}
+
+// [Handler for ShopApi] method: Account, binds params and calls the method
+func (node *ShopApi) handleAccount(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	// validation AccountParams
+	values, ok := cfg.bindValues(w, r, []string{"currency"})
+	if !ok {
+		return
+	}
+	if r.MultipartForm != nil {
+		// net/http removes temp files of the request it made, not of r made by WithContext
+		defer r.MultipartForm.RemoveAll()
+	}
+	paramCurrency := values.Get("currency")
+	// tplDefault
+	if paramCurrency == "" {
+		paramCurrency = "usd"
+	}
+
+	// tplEnum
+	enumFlag := false
+	if paramCurrency == "usd" {
+		enumFlag = true
+	}
+	if paramCurrency == "eur" {
+		enumFlag = true
+	}
+	if !enumFlag {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("currency must be one of [usd, eur]"))
+		return
+	}
+
+	params := AccountParams{
+		Currency: paramCurrency,
+	}
+	ctx, cancel := cfg.methodContext(r, 0)
+	defer cancel()
+	response, err := node.Account(ctx, params)
+	if err != nil {
+		switch err.(type) {
+		case ApiError:
+			cfg.writeError(w, r, err.(ApiError).HTTPStatus, err)
+		default:
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+				cfg.writeError(w, r, http.StatusGatewayTimeout, errors.New("timeout"))
+				return
+			}
+			cfg.Logger.Error("method failed", "method", "Account", "request_id", RequestIDFromContext(ctx), "error", err)
+			cfg.writeError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	data, _ := json.Marshal(apigenResValue{"error": "", "response": response})
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(data))
+}
+
+// CORS policy of ShopApi.Balance
+var apigenCorsShopApiBalance = &CORSPolicy{
+	AllowOrigins: []string{"https://shop.example", "https://admin.example"},
+	AllowHeaders: []string{"X-Auth"},
+}
+
+// middleware chain and concurrency limit of ShopApi.Balance
+var apigenChainShopApiBalance = &apigenChainSpec{
+	service: "ShopApi",
+	names:   nil,
+	handler: func(cfg *HandlerConfig) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Context().Value(apigenNodeKey{}).(*ShopApi).handleBalance(cfg, w, r)
+		})
+	},
+}
+
+// main.methodOptions{URL:"/shop/account/balance", Auth:true, AuthScheme:"query", Method:"GET", Signature:main.signatureOptions{Header:"", Algo:"", TimestampHeader:"", Window:0}, Middleware:[]string(nil), RateLimit:main.rateLimitOptions{RPS:0, Burst:0, Key:""}, Timeout:0, MaxConcurrency:0, QueueWait:0, CORS:main.corsOptions{Origins:[]string{"https://shop.example", "https://admin.example"}, Methods:[]string(nil), Headers:[]string{"X-Auth"}, ExposeHeaders:[]string(nil), Credentials:false, MaxAge:0}, MaxBody:0}
+// [Wrapper for ShopApi] method: Balance
+func (node *ShopApi) wrapperBalance(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	sw := &apigenStatusWriter{ResponseWriter: w}
+	w = sw
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	defer cfg.logAccess(sw, r, "/shop/account/balance", "Balance", time.Now())
+	defer cfg.Metrics.start("/shop/account/balance", "Balance").done(sw, time.Now())
+	if cfg.Tracer != nil {
+		var span Span
+		r, span = cfg.startSpan(r, "ShopApi.Balance", "/shop/account/balance")
+		defer apigenEndSpan(span, sw)
+	}
+	if !cfg.DisableRecovery {
+		defer cfg.recoverPanic(w, r, "Balance")
+	}
+
+	// CORS, preflights are answered here
+	if cfg.handleCORS(w, r, apigenCorsShopApiBalance, "GET") {
+		return
+	}
+
+	// Body limit, bodies known to be too large are rejected before reading
+	if bodyLimit := cfg.MaxBodySize; bodyLimit > 0 {
+		if r.ContentLength > bodyLimit {
+			cfg.writeError(w, r, http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+	}
+
+	// Authorization checker (query)
+	authCred := AuthCredential{Scheme: "query", Token: r.URL.Query().Get("api_key")}
+	if !cfg.AuthVerifier(r, authCred) {
+		cfg.writeError(w, r, http.StatusForbidden, errors.New("unauthorized"))
+		return
+	}
+
+	// Method checker
+	if r.Method != http.MethodGet {
+		cfg.writeError(w, r, http.StatusNotAcceptable, errors.New("bad method"))
+		return
+	}
+
+	// Middlewares run after the checks, before binding params
+	cfg.chain(apigenChainShopApiBalance).handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apigenNodeKey{}, node)))
+}
+
+// [Handler for ShopApi] method: Balance, binds params and calls the method
+func (node *ShopApi) handleBalance(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	// validation AccountParams
+	values, ok := cfg.bindValues(w, r, []string{"currency"})
+	if !ok {
+		return
+	}
+	if r.MultipartForm != nil {
+		// net/http removes temp files of the request it made, not of r made by WithContext
+		defer r.MultipartForm.RemoveAll()
+	}
+	paramCurrency := values.Get("currency")
+	// tplDefault
+	if paramCurrency == "" {
+		paramCurrency = "usd"
+	}
+
+	// tplEnum
+	enumFlag := false
+	if paramCurrency == "usd" {
+		enumFlag = true
+	}
+	if paramCurrency == "eur" {
+		enumFlag = true
+	}
+	if !enumFlag {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("currency must be one of [usd, eur]"))
+		return
+	}
+
+	params := AccountParams{
+		Currency: paramCurrency,
+	}
+	ctx, cancel := cfg.methodContext(r, 0)
+	defer cancel()
+	response, err := node.Balance(ctx, params)
+	if err != nil {
+		switch err.(type) {
+		case ApiError:
+			cfg.writeError(w, r, err.(ApiError).HTTPStatus, err)
+		default:
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+				cfg.writeError(w, r, http.StatusGatewayTimeout, errors.New("timeout"))
+				return
+			}
+			cfg.Logger.Error("method failed", "method", "Balance", "request_id", RequestIDFromContext(ctx), "error", err)
+			cfg.writeError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	data, _ := json.Marshal(apigenResValue{"error": "", "response": response})
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(data))
+}
+
+// CORS policy of ShopApi.History
+var apigenCorsShopApiHistory = &CORSPolicy{
+	AllowOrigins: []string{"https://shop.example", "https://admin.example"},
+	AllowHeaders: []string{"X-Auth"},
+}
+
+// middleware chain and concurrency limit of ShopApi.History
+var apigenChainShopApiHistory = &apigenChainSpec{
+	service: "ShopApi",
+	names:   nil,
+	handler: func(cfg *HandlerConfig) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Context().Value(apigenNodeKey{}).(*ShopApi).handleHistory(cfg, w, r)
+		})
+	},
+}
+
+// main.methodOptions{URL:"/shop/account/history", Auth:true, AuthScheme:"cookie", Method:"GET", Signature:main.signatureOptions{Header:"", Algo:"", TimestampHeader:"", Window:0}, Middleware:[]string(nil), RateLimit:main.rateLimitOptions{RPS:0, Burst:0, Key:""}, Timeout:0, MaxConcurrency:0, QueueWait:0, CORS:main.corsOptions{Origins:[]string{"https://shop.example", "https://admin.example"}, Methods:[]string(nil), Headers:[]string{"X-Auth"}, ExposeHeaders:[]string(nil), Credentials:false, MaxAge:0}, MaxBody:0}
+// [Wrapper for ShopApi] method: History
+func (node *ShopApi) wrapperHistory(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	sw := &apigenStatusWriter{ResponseWriter: w}
+	w = sw
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	defer cfg.logAccess(sw, r, "/shop/account/history", "History", time.Now())
+	defer cfg.Metrics.start("/shop/account/history", "History").done(sw, time.Now())
+	if cfg.Tracer != nil {
+		var span Span
+		r, span = cfg.startSpan(r, "ShopApi.History", "/shop/account/history")
+		defer apigenEndSpan(span, sw)
+	}
+	if !cfg.DisableRecovery {
+		defer cfg.recoverPanic(w, r, "History")
+	}
+
+	// CORS, preflights are answered here
+	if cfg.handleCORS(w, r, apigenCorsShopApiHistory, "GET") {
+		return
+	}
+
+	// Body limit, bodies known to be too large are rejected before reading
+	if bodyLimit := cfg.MaxBodySize; bodyLimit > 0 {
+		if r.ContentLength > bodyLimit {
+			cfg.writeError(w, r, http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+	}
+
+	// Authorization checker (cookie)
+	authCred := AuthCredential{Scheme: "cookie"}
+	if authCookie, err := r.Cookie("api_key"); err == nil {
+		authCred.Token = authCookie.Value
+	}
+	if !cfg.AuthVerifier(r, authCred) {
+		cfg.writeError(w, r, http.StatusForbidden, errors.New("unauthorized"))
+		return
+	}
+
+	// Method checker
+	if r.Method != http.MethodGet {
+		cfg.writeError(w, r, http.StatusNotAcceptable, errors.New("bad method"))
+		return
+	}
+
+	// Middlewares run after the checks, before binding params
+	cfg.chain(apigenChainShopApiHistory).handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apigenNodeKey{}, node)))
+}
+
+// [Handler for ShopApi] method: History, binds params and calls the method
+func (node *ShopApi) handleHistory(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	// validation AccountParams
+	values, ok := cfg.bindValues(w, r, []string{"currency"})
+	if !ok {
+		return
+	}
+	if r.MultipartForm != nil {
+		// net/http removes temp files of the request it made, not of r made by WithContext
+		defer r.MultipartForm.RemoveAll()
+	}
+	paramCurrency := values.Get("currency")
+	// tplDefault
+	if paramCurrency == "" {
+		paramCurrency = "usd"
+	}
+
+	// tplEnum
+	enumFlag := false
+	if paramCurrency == "usd" {
+		enumFlag = true
+	}
+	if paramCurrency == "eur" {
+		enumFlag = true
+	}
+	if !enumFlag {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("currency must be one of [usd, eur]"))
+		return
+	}
+
+	params := AccountParams{
+		Currency: paramCurrency,
+	}
+	ctx, cancel := cfg.methodContext(r, 0)
+	defer cancel()
+	response, err := node.History(ctx, params)
+	if err != nil {
+		switch err.(type) {
+		case ApiError:
+			cfg.writeError(w, r, err.(ApiError).HTTPStatus, err)
+		default:
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+				cfg.writeError(w, r, http.StatusGatewayTimeout, errors.New("timeout"))
+				return
+			}
+			cfg.Logger.Error("method failed", "method", "History", "request_id", RequestIDFromContext(ctx), "error", err)
+			cfg.writeError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	data, _ := json.Marshal(apigenResValue{"error": "", "response": response})
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(data))
+}
+
+// CORS policy of ShopApi.Order
+var apigenCorsShopApiOrder = &CORSPolicy{
+	AllowOrigins: []string{"https://shop.example", "https://admin.example"},
+	AllowHeaders: []string{"X-Auth"},
+}
+
+// middleware chain and concurrency limit of ShopApi.Order
+var apigenChainShopApiOrder = &apigenChainSpec{
+	service: "ShopApi",
+	names:   nil,
+	handler: func(cfg *HandlerConfig) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Context().Value(apigenNodeKey{}).(*ShopApi).handleOrder(cfg, w, r)
+		})
+	},
+}
+
+// main.methodOptions{URL:"/shop/orders", Auth:false, AuthScheme:"", Method:"POST", Signature:main.signatureOptions{Header:"", Algo:"", TimestampHeader:"", Window:0}, Middleware:[]string(nil), RateLimit:main.rateLimitOptions{RPS:1, Burst:2, Key:"ip"}, Timeout:0, MaxConcurrency:0, QueueWait:0, CORS:main.corsOptions{Origins:[]string{"https://shop.example", "https://admin.example"}, Methods:[]string(nil), Headers:[]string{"X-Auth"}, ExposeHeaders:[]string(nil), Credentials:false, MaxAge:0}, MaxBody:16384}
+// [Wrapper for ShopApi] method: Order
+func (node *ShopApi) wrapperOrder(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	sw := &apigenStatusWriter{ResponseWriter: w}
+	w = sw
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	defer cfg.logAccess(sw, r, "/shop/orders", "Order", time.Now())
+	defer cfg.Metrics.start("/shop/orders", "Order").done(sw, time.Now())
+	if cfg.Tracer != nil {
+		var span Span
+		r, span = cfg.startSpan(r, "ShopApi.Order", "/shop/orders")
+		defer apigenEndSpan(span, sw)
+	}
+	if !cfg.DisableRecovery {
+		defer cfg.recoverPanic(w, r, "Order")
+	}
+
+	// CORS, preflights are answered here
+	if cfg.handleCORS(w, r, apigenCorsShopApiOrder, "POST") {
+		return
+	}
+
+	// Body limit, bodies known to be too large are rejected before reading
+	if bodyLimit := int64(16384); bodyLimit > 0 {
+		if r.ContentLength > bodyLimit {
+			cfg.writeError(w, r, http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+	}
+
+	// Rate limit (1 rps, burst 2 by ip)
+	if cfg.RateLimitStore != nil {
+		rateKey := apigenClientIP(r)
+		if ok, retryAfter := cfg.RateLimitStore.Allow("ShopApi.Order:"+rateKey, 1, 2, time.Now()); !ok {
+			cfg.rateLimited(w, r, retryAfter)
+			return
+		}
+	}
+
+	// Method checker
+	if r.Method != http.MethodPost {
+		cfg.writeError(w, r, http.StatusNotAcceptable, errors.New("bad method"))
+		return
+	}
+
+	// Middlewares run after the checks, before binding params
+	cfg.chain(apigenChainShopApiOrder).handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apigenNodeKey{}, node)))
+}
+
+// [Handler for ShopApi] method: Order, binds params and calls the method
+func (node *ShopApi) handleOrder(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	// validation OrderParams
+	values, ok := cfg.bindValues(w, r, []string{"item", "count"})
+	if !ok {
+		return
+	}
+	if r.MultipartForm != nil {
+		// net/http removes temp files of the request it made, not of r made by WithContext
+		defer r.MultipartForm.RemoveAll()
+	}
+	paramItem := values.Get("item")
+	// tplRequired
+	if paramItem == "" {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("item must me not empty"))
+		return
+	}
+
+	paramCount := values.Get("count")
+	// tplMin
+	paramCountIntMin, err := strconv.Atoi(paramCount)
+	if err != nil {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("count must be int"))
+		return
+	}
+	if paramCountIntMin < 1 {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("count must be >= 1"))
+		return
+	}
+
+	// tplMax
+	paramCountIntMax, err := strconv.Atoi(paramCount)
+	if err != nil {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("count must be int"))
+		return
+	}
+	if paramCountIntMax > 10 {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("count must be <= 10"))
+		return
+	}
+
+	paramCountInt, _ := strconv.Atoi(paramCount)
+	params := OrderParams{
+		Item:  paramItem,
+		Count: paramCountInt,
+	}
+	ctx, cancel := cfg.methodContext(r, 0)
+	defer cancel()
+	response, err := node.Order(ctx, params)
+	if err != nil {
+		switch err.(type) {
+		case ApiError:
+			cfg.writeError(w, r, err.(ApiError).HTTPStatus, err)
+		default:
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+				cfg.writeError(w, r, http.StatusGatewayTimeout, errors.New("timeout"))
+				return
+			}
+			cfg.Logger.Error("method failed", "method", "Order", "request_id", RequestIDFromContext(ctx), "error", err)
+			cfg.writeError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	data, _ := json.Marshal(apigenResValue{"error": "", "response": response})
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(data))
+}
+
+// CORS policy of ShopApi.Search
+var apigenCorsShopApiSearch = &CORSPolicy{
+	AllowOrigins: []string{"https://shop.example", "https://admin.example"},
+	AllowHeaders: []string{"X-Auth"},
+}
+
+// middleware chain and concurrency limit of ShopApi.Search
+var apigenChainShopApiSearch = &apigenChainSpec{
+	service: "ShopApi",
+	names:   nil,
+	handler: func(cfg *HandlerConfig) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Context().Value(apigenNodeKey{}).(*ShopApi).handleSearch(cfg, w, r)
+		})
+	},
+}
+
+// main.methodOptions{URL:"/shop/search", Auth:false, AuthScheme:"", Method:"GET", Signature:main.signatureOptions{Header:"", Algo:"", TimestampHeader:"", Window:0}, Middleware:[]string(nil), RateLimit:main.rateLimitOptions{RPS:1, Burst:1, Key:"header:X-Api-Key"}, Timeout:0, MaxConcurrency:0, QueueWait:0, CORS:main.corsOptions{Origins:[]string{"https://shop.example", "https://admin.example"}, Methods:[]string(nil), Headers:[]string{"X-Auth"}, ExposeHeaders:[]string(nil), Credentials:false, MaxAge:0}, MaxBody:0}
+// [Wrapper for ShopApi] method: Search
+func (node *ShopApi) wrapperSearch(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	sw := &apigenStatusWriter{ResponseWriter: w}
+	w = sw
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	defer cfg.logAccess(sw, r, "/shop/search", "Search", time.Now())
+	defer cfg.Metrics.start("/shop/search", "Search").done(sw, time.Now())
+	if cfg.Tracer != nil {
+		var span Span
+		r, span = cfg.startSpan(r, "ShopApi.Search", "/shop/search")
+		defer apigenEndSpan(span, sw)
+	}
+	if !cfg.DisableRecovery {
+		defer cfg.recoverPanic(w, r, "Search")
+	}
+
+	// CORS, preflights are answered here
+	if cfg.handleCORS(w, r, apigenCorsShopApiSearch, "GET") {
+		return
+	}
+
+	// Body limit, bodies known to be too large are rejected before reading
+	if bodyLimit := cfg.MaxBodySize; bodyLimit > 0 {
+		if r.ContentLength > bodyLimit {
+			cfg.writeError(w, r, http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+	}
+
+	// Rate limit (1 rps, burst 1 by header:X-Api-Key)
+	if cfg.RateLimitStore != nil {
+		rateKey := apigenClientIP(r)
+		if apiKey := r.Header.Get("X-Api-Key"); apiKey != "" {
+			rateKey = apigenSecretKey(apiKey)
+		}
+		if ok, retryAfter := cfg.RateLimitStore.Allow("ShopApi.Search:"+rateKey, 1, 1, time.Now()); !ok {
+			cfg.rateLimited(w, r, retryAfter)
+			return
+		}
+	}
+
+	// Method checker
+	if r.Method != http.MethodGet {
+		cfg.writeError(w, r, http.StatusNotAcceptable, errors.New("bad method"))
+		return
+	}
+
+	// Middlewares run after the checks, before binding params
+	cfg.chain(apigenChainShopApiSearch).handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apigenNodeKey{}, node)))
+}
+
+// [Handler for ShopApi] method: Search, binds params and calls the method
+func (node *ShopApi) handleSearch(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	// validation SearchParams
+	values, ok := cfg.bindValues(w, r, []string{"q"})
+	if !ok {
+		return
+	}
+	if r.MultipartForm != nil {
+		// net/http removes temp files of the request it made, not of r made by WithContext
+		defer r.MultipartForm.RemoveAll()
+	}
+	paramQuery := values.Get("q")
+	// tplRequired
+	if paramQuery == "" {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("query must me not empty"))
+		return
+	}
+
+	params := SearchParams{
+		Query: paramQuery,
+	}
+	ctx, cancel := cfg.methodContext(r, 0)
+	defer cancel()
+	response, err := node.Search(ctx, params)
+	if err != nil {
+		switch err.(type) {
+		case ApiError:
+			cfg.writeError(w, r, err.(ApiError).HTTPStatus, err)
+		default:
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+				cfg.writeError(w, r, http.StatusGatewayTimeout, errors.New("timeout"))
+				return
+			}
+			cfg.Logger.Error("method failed", "method", "Search", "request_id", RequestIDFromContext(ctx), "error", err)
+			cfg.writeError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	data, _ := json.Marshal(apigenResValue{"error": "", "response": response})
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(data))
+}
+
+// CORS policy of ShopApi.Quote
+var apigenCorsShopApiQuote = &CORSPolicy{
+	AllowOrigins: []string{"https://shop.example", "https://admin.example"},
+	AllowHeaders: []string{"X-Auth"},
+}
+
+// middleware chain and concurrency limit of ShopApi.Quote
+var apigenChainShopApiQuote = &apigenChainSpec{
+	service: "ShopApi",
+	names:   nil,
+	handler: func(cfg *HandlerConfig) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Context().Value(apigenNodeKey{}).(*ShopApi).handleQuote(cfg, w, r)
+		})
+	},
+}
+
+// main.methodOptions{URL:"/shop/quote", Auth:false, AuthScheme:"", Method:"GET", Signature:main.signatureOptions{Header:"", Algo:"", TimestampHeader:"", Window:0}, Middleware:[]string(nil), RateLimit:main.rateLimitOptions{RPS:0, Burst:0, Key:""}, Timeout:50000000, MaxConcurrency:0, QueueWait:0, CORS:main.corsOptions{Origins:[]string{"https://shop.example", "https://admin.example"}, Methods:[]string(nil), Headers:[]string{"X-Auth"}, ExposeHeaders:[]string(nil), Credentials:false, MaxAge:0}, MaxBody:0}
+// [Wrapper for ShopApi] method: Quote
+func (node *ShopApi) wrapperQuote(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	sw := &apigenStatusWriter{ResponseWriter: w}
+	w = sw
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	defer cfg.logAccess(sw, r, "/shop/quote", "Quote", time.Now())
+	defer cfg.Metrics.start("/shop/quote", "Quote").done(sw, time.Now())
+	if cfg.Tracer != nil {
+		var span Span
+		r, span = cfg.startSpan(r, "ShopApi.Quote", "/shop/quote")
+		defer apigenEndSpan(span, sw)
+	}
+	if !cfg.DisableRecovery {
+		defer cfg.recoverPanic(w, r, "Quote")
+	}
+
+	// CORS, preflights are answered here
+	if cfg.handleCORS(w, r, apigenCorsShopApiQuote, "GET") {
+		return
+	}
+
+	// Body limit, bodies known to be too large are rejected before reading
+	if bodyLimit := cfg.MaxBodySize; bodyLimit > 0 {
+		if r.ContentLength > bodyLimit {
+			cfg.writeError(w, r, http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+	}
+
+	// Method checker
+	if r.Method != http.MethodGet {
+		cfg.writeError(w, r, http.StatusNotAcceptable, errors.New("bad method"))
+		return
+	}
+
+	// Middlewares run after the checks, before binding params
+	cfg.chain(apigenChainShopApiQuote).handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apigenNodeKey{}, node)))
+}
+
+// [Handler for ShopApi] method: Quote, binds params and calls the method
+func (node *ShopApi) handleQuote(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	// validation QuoteParams
+	values, ok := cfg.bindValues(w, r, []string{"item", "wait"})
+	if !ok {
+		return
+	}
+	if r.MultipartForm != nil {
+		// net/http removes temp files of the request it made, not of r made by WithContext
+		defer r.MultipartForm.RemoveAll()
+	}
+	paramItem := values.Get("item")
+	// tplRequired
+	if paramItem == "" {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("item must me not empty"))
+		return
+	}
+
+	paramWait := values.Get("wait")
+	// tplMin
+	paramWaitIntMin, err := strconv.Atoi(paramWait)
+	if err != nil {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("wait must be int"))
+		return
+	}
+	if paramWaitIntMin < 0 {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("wait must be >= 0"))
+		return
+	}
+
+	// tplMax
+	paramWaitIntMax, err := strconv.Atoi(paramWait)
+	if err != nil {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("wait must be int"))
+		return
+	}
+	if paramWaitIntMax > 1000 {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("wait must be <= 1000"))
+		return
+	}
+
+	paramWaitInt, _ := strconv.Atoi(paramWait)
+	params := QuoteParams{
+		Item: paramItem,
+		Wait: paramWaitInt,
+	}
+	ctx, cancel := cfg.methodContext(r, 50*time.Millisecond)
+	defer cancel()
+	response, err := node.Quote(ctx, params)
+	if err != nil {
+		switch err.(type) {
+		case ApiError:
+			cfg.writeError(w, r, err.(ApiError).HTTPStatus, err)
+		default:
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+				cfg.writeError(w, r, http.StatusGatewayTimeout, errors.New("timeout"))
+				return
+			}
+			cfg.Logger.Error("method failed", "method", "Quote", "request_id", RequestIDFromContext(ctx), "error", err)
+			cfg.writeError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	data, _ := json.Marshal(apigenResValue{"error": "", "response": response})
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(data))
+}
+
+// CORS policy of ShopApi.Checkout
+var apigenCorsShopApiCheckout = &CORSPolicy{
+	AllowOrigins: []string{"https://shop.example", "https://admin.example"},
+	AllowHeaders: []string{"X-Auth"},
+}
+
+// middleware chain and concurrency limit of ShopApi.Checkout
+var apigenChainShopApiCheckout = &apigenChainSpec{
+	service:        "ShopApi",
+	names:          nil,
+	maxConcurrency: 1,
+	handler: func(cfg *HandlerConfig) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Context().Value(apigenNodeKey{}).(*ShopApi).handleCheckout(cfg, w, r)
+		})
+	},
+}
+
+// main.methodOptions{URL:"/shop/checkout", Auth:false, AuthScheme:"", Method:"POST", Signature:main.signatureOptions{Header:"", Algo:"", TimestampHeader:"", Window:0}, Middleware:[]string(nil), RateLimit:main.rateLimitOptions{RPS:0, Burst:0, Key:""}, Timeout:0, MaxConcurrency:1, QueueWait:20000000, CORS:main.corsOptions{Origins:[]string{"https://shop.example", "https://admin.example"}, Methods:[]string(nil), Headers:[]string{"X-Auth"}, ExposeHeaders:[]string(nil), Credentials:false, MaxAge:0}, MaxBody:0}
+// [Wrapper for ShopApi] method: Checkout
+func (node *ShopApi) wrapperCheckout(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	sw := &apigenStatusWriter{ResponseWriter: w}
+	w = sw
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	defer cfg.logAccess(sw, r, "/shop/checkout", "Checkout", time.Now())
+	defer cfg.Metrics.start("/shop/checkout", "Checkout").done(sw, time.Now())
+	if cfg.Tracer != nil {
+		var span Span
+		r, span = cfg.startSpan(r, "ShopApi.Checkout", "/shop/checkout")
+		defer apigenEndSpan(span, sw)
+	}
+	if !cfg.DisableRecovery {
+		defer cfg.recoverPanic(w, r, "Checkout")
+	}
+
+	// CORS, preflights are answered here
+	if cfg.handleCORS(w, r, apigenCorsShopApiCheckout, "POST") {
+		return
+	}
+
+	// Body limit, bodies known to be too large are rejected before reading
+	if bodyLimit := cfg.MaxBodySize; bodyLimit > 0 {
+		if r.ContentLength > bodyLimit {
+			cfg.writeError(w, r, http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+	}
+
+	// Method checker
+	if r.Method != http.MethodPost {
+		cfg.writeError(w, r, http.StatusNotAcceptable, errors.New("bad method"))
+		return
+	}
+
+	// Concurrency limit (1 calls, queue wait 20 * time.Millisecond)
+	slots := apigenConcurrencyLimit(cfg.chain(apigenChainShopApiCheckout).slots)
+	if !slots.acquire(r.Context(), 20*time.Millisecond) {
+		cfg.Metrics.shed("/shop/checkout", "Checkout")
+		w.Header().Set("Retry-After", "1")
+		cfg.writeError(w, r, http.StatusServiceUnavailable, errors.New("overloaded"))
+		return
+	}
+	defer slots.release()
+
+	// Middlewares run after the checks, before binding params
+	cfg.chain(apigenChainShopApiCheckout).handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apigenNodeKey{}, node)))
+}
+
+// [Handler for ShopApi] method: Checkout, binds params and calls the method
+func (node *ShopApi) handleCheckout(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	// validation OrderParams
+	values, ok := cfg.bindValues(w, r, []string{"item", "count"})
+	if !ok {
+		return
+	}
+	if r.MultipartForm != nil {
+		// net/http removes temp files of the request it made, not of r made by WithContext
+		defer r.MultipartForm.RemoveAll()
+	}
+	paramItem := values.Get("item")
+	// tplRequired
+	if paramItem == "" {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("item must me not empty"))
+		return
+	}
+
+	paramCount := values.Get("count")
+	// tplMin
+	paramCountIntMin, err := strconv.Atoi(paramCount)
+	if err != nil {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("count must be int"))
+		return
+	}
+	if paramCountIntMin < 1 {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("count must be >= 1"))
+		return
+	}
+
+	// tplMax
+	paramCountIntMax, err := strconv.Atoi(paramCount)
+	if err != nil {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("count must be int"))
+		return
+	}
+	if paramCountIntMax > 10 {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("count must be <= 10"))
+		return
+	}
+
+	paramCountInt, _ := strconv.Atoi(paramCount)
+	params := OrderParams{
+		Item:  paramItem,
+		Count: paramCountInt,
+	}
+	ctx, cancel := cfg.methodContext(r, 0)
+	defer cancel()
+	response, err := node.Checkout(ctx, params)
+	if err != nil {
+		switch err.(type) {
+		case ApiError:
+			cfg.writeError(w, r, err.(ApiError).HTTPStatus, err)
+		default:
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+				cfg.writeError(w, r, http.StatusGatewayTimeout, errors.New("timeout"))
+				return
+			}
+			cfg.Logger.Error("method failed", "method", "Checkout", "request_id", RequestIDFromContext(ctx), "error", err)
+			cfg.writeError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	data, _ := json.Marshal(apigenResValue{"error": "", "response": response})
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(data))
+}
+
+// CORS policy of ShopApi.AddToCart
+var apigenCorsShopApiAddToCart = &CORSPolicy{
+	AllowOrigins: []string{"https://shop.example", "https://admin.example"},
+	AllowHeaders: []string{"X-Auth"},
+}
+
+// middleware chain and concurrency limit of ShopApi.AddToCart
+var apigenChainShopApiAddToCart = &apigenChainSpec{
+	service: "ShopApi",
+	names:   nil,
+	handler: func(cfg *HandlerConfig) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Context().Value(apigenNodeKey{}).(*ShopApi).handleAddToCart(cfg, w, r)
+		})
+	},
+}
+
+// main.methodOptions{URL:"/shop/carts/{id}/items", Auth:false, AuthScheme:"", Method:"POST", Signature:main.signatureOptions{Header:"", Algo:"", TimestampHeader:"", Window:0}, Middleware:[]string(nil), RateLimit:main.rateLimitOptions{RPS:0, Burst:0, Key:""}, Timeout:0, MaxConcurrency:0, QueueWait:0, CORS:main.corsOptions{Origins:[]string{"https://shop.example", "https://admin.example"}, Methods:[]string(nil), Headers:[]string{"X-Auth"}, ExposeHeaders:[]string(nil), Credentials:false, MaxAge:0}, MaxBody:0}
+// [Wrapper for ShopApi] method: AddToCart
+func (node *ShopApi) wrapperAddToCart(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	sw := &apigenStatusWriter{ResponseWriter: w}
+	w = sw
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	defer cfg.logAccess(sw, r, "/shop/carts/{id}/items", "AddToCart", time.Now())
+	defer cfg.Metrics.start("/shop/carts/{id}/items", "AddToCart").done(sw, time.Now())
+	if cfg.Tracer != nil {
+		var span Span
+		r, span = cfg.startSpan(r, "ShopApi.AddToCart", "/shop/carts/{id}/items")
+		defer apigenEndSpan(span, sw)
+	}
+	if !cfg.DisableRecovery {
+		defer cfg.recoverPanic(w, r, "AddToCart")
+	}
+
+	// CORS, preflights are answered here
+	if cfg.handleCORS(w, r, apigenCorsShopApiAddToCart, "POST") {
+		return
+	}
+
+	// Body limit, bodies known to be too large are rejected before reading
+	if bodyLimit := cfg.MaxBodySize; bodyLimit > 0 {
+		if r.ContentLength > bodyLimit {
+			cfg.writeError(w, r, http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+	}
+
+	// Method checker
+	if r.Method != http.MethodPost {
+		cfg.writeError(w, r, http.StatusNotAcceptable, errors.New("bad method"))
+		return
+	}
+
+	// Middlewares run after the checks, before binding params
+	cfg.chain(apigenChainShopApiAddToCart).handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apigenNodeKey{}, node)))
+}
+
+// [Handler for ShopApi] method: AddToCart, binds params and calls the method
+func (node *ShopApi) handleAddToCart(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	// validation CartParams
+	values, ok := cfg.bindValues(w, r, []string{"item", "coupon"})
+	if !ok {
+		return
+	}
+	if r.MultipartForm != nil {
+		// net/http removes temp files of the request it made, not of r made by WithContext
+		defer r.MultipartForm.RemoveAll()
+	}
+	paramCart := PathParam(r, "id")
+	paramItem := values.body.Get("item")
+	// tplRequired
+	if paramItem == "" {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("item must me not empty"))
+		return
+	}
+
+	paramCoupon := values.query.Get("coupon")
+	paramSession := apigenCookieValue(r, "session")
+	// tplRequired
+	if paramSession == "" {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("session must me not empty"))
+		return
+	}
+
+	paramVersion := r.Header.Get("X-Client-Version")
+	// tplMin
+	if len([]rune(paramVersion)) < 1 {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("version len must be >= 1"))
+		return
+	}
+
+	params := CartParams{
+		Cart:    paramCart,
+		Item:    paramItem,
+		Coupon:  paramCoupon,
+		Session: paramSession,
+		Version: paramVersion,
+	}
+	ctx, cancel := cfg.methodContext(r, 0)
+	defer cancel()
+	response, err := node.AddToCart(ctx, params)
+	if err != nil {
+		switch err.(type) {
+		case ApiError:
+			cfg.writeError(w, r, err.(ApiError).HTTPStatus, err)
+		default:
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+				cfg.writeError(w, r, http.StatusGatewayTimeout, errors.New("timeout"))
+				return
+			}
+			cfg.Logger.Error("method failed", "method", "AddToCart", "request_id", RequestIDFromContext(ctx), "error", err)
+			cfg.writeError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	data, _ := json.Marshal(apigenResValue{"error": "", "response": response})
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(data))
+}
+
+// CORS policy of ShopApi.Photo
+var apigenCorsShopApiPhoto = &CORSPolicy{
+	AllowOrigins: []string{"https://shop.example", "https://admin.example"},
+	AllowHeaders: []string{"X-Auth"},
+}
+
+// middleware chain and concurrency limit of ShopApi.Photo
+var apigenChainShopApiPhoto = &apigenChainSpec{
+	service: "ShopApi",
+	names:   nil,
+	handler: func(cfg *HandlerConfig) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Context().Value(apigenNodeKey{}).(*ShopApi).handlePhoto(cfg, w, r)
+		})
+	},
+}
+
+// main.methodOptions{URL:"/shop/items/{id}/photo", Auth:false, AuthScheme:"", Method:"POST", Signature:main.signatureOptions{Header:"", Algo:"", TimestampHeader:"", Window:0}, Middleware:[]string(nil), RateLimit:main.rateLimitOptions{RPS:0, Burst:0, Key:""}, Timeout:0, MaxConcurrency:0, QueueWait:0, CORS:main.corsOptions{Origins:[]string{"https://shop.example", "https://admin.example"}, Methods:[]string(nil), Headers:[]string{"X-Auth"}, ExposeHeaders:[]string(nil), Credentials:false, MaxAge:0}, MaxBody:2097152}
+// [Wrapper for ShopApi] method: Photo
+func (node *ShopApi) wrapperPhoto(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	sw := &apigenStatusWriter{ResponseWriter: w}
+	w = sw
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	defer cfg.logAccess(sw, r, "/shop/items/{id}/photo", "Photo", time.Now())
+	defer cfg.Metrics.start("/shop/items/{id}/photo", "Photo").done(sw, time.Now())
+	if cfg.Tracer != nil {
+		var span Span
+		r, span = cfg.startSpan(r, "ShopApi.Photo", "/shop/items/{id}/photo")
+		defer apigenEndSpan(span, sw)
+	}
+	if !cfg.DisableRecovery {
+		defer cfg.recoverPanic(w, r, "Photo")
+	}
+
+	// CORS, preflights are answered here
+	if cfg.handleCORS(w, r, apigenCorsShopApiPhoto, "POST") {
+		return
+	}
+
+	// Body limit, bodies known to be too large are rejected before reading
+	if bodyLimit := int64(2097152); bodyLimit > 0 {
+		if r.ContentLength > bodyLimit {
+			cfg.writeError(w, r, http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+	}
+
+	// Method checker
+	if r.Method != http.MethodPost {
+		cfg.writeError(w, r, http.StatusNotAcceptable, errors.New("bad method"))
+		return
+	}
+
+	// Middlewares run after the checks, before binding params
+	cfg.chain(apigenChainShopApiPhoto).handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apigenNodeKey{}, node)))
+}
+
+// [Handler for ShopApi] method: Photo, binds params and calls the method
+func (node *ShopApi) handlePhoto(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	// validation PhotoParams
+	_, ok := cfg.bindValues(w, r, nil)
+	if !ok {
+		return
+	}
+	if r.MultipartForm != nil {
+		// net/http removes temp files of the request it made, not of r made by WithContext
+		defer r.MultipartForm.RemoveAll()
+	}
+	paramID := PathParam(r, "id")
+	// tplRequired
+	if paramID == "" {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("id must me not empty"))
+		return
+	}
+
+	paramPhotoFiles, err := apigenFormFiles(r, "photo", apigenFileRules{name: "photo", required: true, maxSize: 1048576, maxSizeText: "1MB", types: []string{"image/png", "image/jpeg"}})
+	if err != nil {
+		cfg.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+	paramThumbsFiles, err := apigenFormFiles(r, "thumbs", apigenFileRules{name: "thumbs", maxCount: 2, maxSize: 65536, maxSizeText: "64KB", types: []string{"image/*"}})
+	if err != nil {
+		cfg.writeError(w, r, http.StatusBadRequest, err)
 		return
 	}
-
-	params := ProfileParams{
-		Login: paramLogin,
+	params := PhotoParams{
+		ID:     paramID,
+		Photo:  apigenFirstFile(paramPhotoFiles),
+		Thumbs: paramThumbsFiles,
 	}
-	ctx := r.Context()
-	response, err := node.Profile(ctx, params)
+	ctx, cancel := cfg.methodContext(r, 0)
+	defer cancel()
+	response, err := node.Photo(ctx, params)
 	if err != nil {
 		switch err.(type) {
 		case ApiError:
-			data, _ := json.Marshal(resValue{"error": err.(ApiError).Err.Error()})
-			w.WriteHeader(err.(ApiError).HTTPStatus)
-			io.WriteString(w, string(data))
+			cfg.writeError(w, r, err.(ApiError).HTTPStatus, err)
 		default:
-			data, _ := json.Marshal(resValue{"error": err.Error()})
-			w.WriteHeader(http.StatusInternalServerError)
-			io.WriteString(w, string(data))
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+				cfg.writeError(w, r, http.StatusGatewayTimeout, errors.New("timeout"))
+				return
+			}
+			cfg.Logger.Error("method failed", "method", "Photo", "request_id", RequestIDFromContext(ctx), "error", err)
+			cfg.writeError(w, r, http.StatusInternalServerError, err)
 		}
 		return
 	}
-	data, _ := json.Marshal(resValue{"error": "", "response": response})
+	data, _ := json.Marshal(apigenResValue{"error": "", "response": response})
 	w.WriteHeader(http.StatusOK)
-	io.WriteString(w, string(data))	
+	io.WriteString(w, string(data))
 }
 
-// main.methodOptions{URL:"/user/create", Auth:true, Method:"POST"}
-// [Wrapper for MyApi] method: Create
-func (node *MyApi) wrapperCreate(w http.ResponseWriter, r *http.Request) {
-	// Authorization checker	
-	authGood := "100500"
-	auth := r.Header.Get("X-Auth")
-	if auth != authGood {
-		w.WriteHeader(http.StatusForbidden)
-		data, _ := json.Marshal(resValue{"error": "unauthorized"})
-		io.WriteString(w, string(data))
+// CORS policy of ShopApi.Payment
+var apigenCorsShopApiPayment = &CORSPolicy{
+	AllowOrigins: []string{"https://shop.example", "https://admin.example"},
+	AllowHeaders: []string{"X-Auth"},
+}
+
+// middleware chain and concurrency limit of ShopApi.Payment
+var apigenChainShopApiPayment = &apigenChainSpec{
+	service: "ShopApi",
+	names:   nil,
+	handler: func(cfg *HandlerConfig) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Context().Value(apigenNodeKey{}).(*ShopApi).handlePayment(cfg, w, r)
+		})
+	},
+}
+
+// main.methodOptions{URL:"/shop/hooks/payment", Auth:false, AuthScheme:"", Method:"POST", Signature:main.signatureOptions{Header:"X-Signature", Algo:"sha256", TimestampHeader:"X-Timestamp", Window:300}, Middleware:[]string(nil), RateLimit:main.rateLimitOptions{RPS:0, Burst:0, Key:""}, Timeout:0, MaxConcurrency:0, QueueWait:0, CORS:main.corsOptions{Origins:[]string{"https://shop.example", "https://admin.example"}, Methods:[]string(nil), Headers:[]string{"X-Auth"}, ExposeHeaders:[]string(nil), Credentials:false, MaxAge:0}, MaxBody:0}
+// [Wrapper for ShopApi] method: Payment
+func (node *ShopApi) wrapperPayment(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	sw := &apigenStatusWriter{ResponseWriter: w}
+	w = sw
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	defer cfg.logAccess(sw, r, "/shop/hooks/payment", "Payment", time.Now())
+	defer cfg.Metrics.start("/shop/hooks/payment", "Payment").done(sw, time.Now())
+	if cfg.Tracer != nil {
+		var span Span
+		r, span = cfg.startSpan(r, "ShopApi.Payment", "/shop/hooks/payment")
+		defer apigenEndSpan(span, sw)
+	}
+	if !cfg.DisableRecovery {
+		defer cfg.recoverPanic(w, r, "Payment")
+	}
+
+	// CORS, preflights are answered here
+	if cfg.handleCORS(w, r, apigenCorsShopApiPayment, "POST") {
 		return
-	} 	
+	}
+
+	// Body limit, bodies known to be too large are rejected before reading
+	if bodyLimit := cfg.MaxBodySize; bodyLimit > 0 {
+		if r.ContentLength > bodyLimit {
+			cfg.writeError(w, r, http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+	}
 
 	// Method checker
 	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusNotAcceptable)
-		data, _ := json.Marshal(resValue{"error": "bad method"})
-		io.WriteString(w, string(data))	
+		cfg.writeError(w, r, http.StatusNotAcceptable, errors.New("bad method"))
 		return
 	}
 
-	// validation CreateParams
-	r.ParseForm()
-	paramLogin := r.Form.Get("login")
-	// tplRequired
-	if paramLogin == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		data, _ := json.Marshal(resValue{"error": "login must me not empty"})
-		io.WriteString(w, string(data))
+	// Signature checker (sha256 in X-Signature)
+	rawBody, err := io.ReadAll(r.Body)
+	if err != nil {
+		cfg.writeBodyError(w, r, err, "cant read body")
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(rawBody))
+	sigTimestamp, err := strconv.ParseInt(r.Header.Get("X-Timestamp"), 10, 64)
+	if err != nil || time.Since(time.Unix(sigTimestamp, 0)).Abs() > 300*time.Second {
+		cfg.writeError(w, r, http.StatusUnauthorized, errors.New("bad signature timestamp"))
+		return
+	}
+	sigSecret, err := node.SignatureSecret(r, "Payment")
+	if err != nil {
+		cfg.writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	sigMAC := hmac.New(sha256.New, sigSecret)
+	sigMAC.Write([]byte(r.Header.Get("X-Timestamp") + "."))
+	sigMAC.Write(rawBody)
+	sigGot, err := hex.DecodeString(strings.TrimPrefix(r.Header.Get("X-Signature"), "sha256="))
+	if err != nil || !hmac.Equal(sigGot, sigMAC.Sum(nil)) {
+		cfg.writeError(w, r, http.StatusUnauthorized, errors.New("bad signature"))
 		return
 	}
 
-	// tplMin
-	if len([]rune(paramLogin)) < 10 {
-		w.WriteHeader(http.StatusBadRequest)
-		data, _ := json.Marshal(resValue{"error": "login len must be >= 10"})
-		io.WriteString(w, string(data))
-		return 
-	}
-	
-	paramName := r.Form.Get("full_name")
-	paramStatus := r.Form.Get("status")
-	// tplDefault	
-	if paramStatus == "" {
-		paramStatus = "user"
+	// Middlewares run after the checks, before binding params
+	cfg.chain(apigenChainShopApiPayment).handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apigenNodeKey{}, node)))
+}
+
+// [Handler for ShopApi] method: Payment, binds params and calls the method
+func (node *ShopApi) handlePayment(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	// validation PaymentParams
+	values, ok := cfg.bindValues(w, r, []string{"order", "status"})
+	if !ok {
+		return
+	}
+	if r.MultipartForm != nil {
+		// net/http removes temp files of the request it made, not of r made by WithContext
+		defer r.MultipartForm.RemoveAll()
+	}
+	paramOrder := values.Get("order")
+	// tplRequired
+	if paramOrder == "" {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("order must me not empty"))
+		return
 	}
 
+	paramStatus := values.Get("status")
 	// tplEnum
-	enumFlag := false	
-	if paramStatus == "user" {
+	enumFlag := false
+	if paramStatus == "paid" {
 		enumFlag = true
 	}
-	if paramStatus == "moderator" {
-		enumFlag = true
-	}
-	if paramStatus == "admin" {
+	if paramStatus == "failed" {
 		enumFlag = true
 	}
 	if !enumFlag {
-		w.WriteHeader(http.StatusBadRequest)
-		data, _ := json.Marshal(resValue{"error": "status must be one of [user, moderator, admin]"})
-		io.WriteString(w, string(data))
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("status must be one of [paid, failed]"))
 		return
 	}
 
-	paramAge := r.Form.Get("age")
-	// tplMin
-	paramAgeIntMin, err := strconv.Atoi(paramAge)
+	params := PaymentParams{
+		Order:  paramOrder,
+		Status: paramStatus,
+	}
+	ctx, cancel := cfg.methodContext(r, 0)
+	defer cancel()
+	response, err := node.Payment(ctx, params)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		data, _ := json.Marshal(resValue{"error": "age must be int"})
-		io.WriteString(w, string(data))
+		switch err.(type) {
+		case ApiError:
+			cfg.writeError(w, r, err.(ApiError).HTTPStatus, err)
+		default:
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+				cfg.writeError(w, r, http.StatusGatewayTimeout, errors.New("timeout"))
+				return
+			}
+			cfg.Logger.Error("method failed", "method", "Payment", "request_id", RequestIDFromContext(ctx), "error", err)
+			cfg.writeError(w, r, http.StatusInternalServerError, err)
+		}
 		return
 	}
-	if paramAgeIntMin < 0 {
-		w.WriteHeader(http.StatusBadRequest)
-		data, _ := json.Marshal(resValue{"error": "age must be >= 0"})
-		io.WriteString(w, string(data))
-		return 
+	data, _ := json.Marshal(apigenResValue{"error": "", "response": response})
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(data))
+}
+
+// middleware chains of ShopApi built by constructors
+var apigenChainsShopApi = []*apigenChainSpec{apigenChainShopApiPublic, apigenChainShopApiItem, apigenChainShopApiFeatured, apigenChainShopApiDownload, apigenChainShopApiAccount, apigenChainShopApiBalance, apigenChainShopApiHistory, apigenChainShopApiOrder, apigenChainShopApiSearch, apigenChainShopApiQuote, apigenChainShopApiCheckout, apigenChainShopApiAddToCart, apigenChainShopApiPhoto, apigenChainShopApiPayment}
+
+// routes of ShopApi
+var apigenRoutesShopApi = &apigenRouteNode{static: map[string]*apigenRouteNode{
+	"shop": {static: map[string]*apigenRouteNode{
+		"account": {static: map[string]*apigenRouteNode{
+			"balance": {route: 6},
+			"history": {route: 7},
+		}, route: 5},
+		"carts": {param: &apigenRouteNode{static: map[string]*apigenRouteNode{
+			"items": {route: 12},
+		}}},
+		"checkout": {route: 11},
+		"files":    {catchAll: 4},
+		"hooks": {static: map[string]*apigenRouteNode{
+			"payment": {route: 14},
+		}},
+		"items": {static: map[string]*apigenRouteNode{
+			"featured": {route: 3},
+		}, param: &apigenRouteNode{static: map[string]*apigenRouteNode{
+			"photo": {route: 13},
+		}, route: 2}},
+		"orders": {route: 8},
+		"public": {route: 1},
+		"quote":  {route: 10},
+		"search": {route: 9},
+	}},
+}}
+
+// ServeHTTP for ShopApi
+func (node *ShopApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cfg := &DefaultHandlerConfig
+	// before routing, so redirects, 404 and 406 carry the ID too
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
 	}
-	
-	// tplMax
-	paramAgeIntMax, err := strconv.Atoi(paramAge)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		data, _ := json.Marshal(resValue{"error": "age must be int"})
-		io.WriteString(w, string(data))
+	var pathValues [apigenMaxPathParams]string
+	route, handled := apigenRouteRequest(apigenRoutesShopApi, w, r, &pathValues)
+	if handled {
 		return
 	}
-	if paramAgeIntMax > 128 {
-		w.WriteHeader(http.StatusBadRequest)
-		data, _ := json.Marshal(resValue{"error": "age must be <= 128"})
-		io.WriteString(w, string(data))
-		return 
+	switch route {
+	case 1: // /shop/public
+		node.wrapperPublic(cfg, w, r)
+	case 2: // /shop/items/{id}
+		node.wrapperItem(cfg, w, apigenWithPathParams(r, []string{"id"}, &pathValues))
+	case 3: // /shop/items/featured
+		node.wrapperFeatured(cfg, w, r)
+	case 4: // /shop/files/{path...}
+		node.wrapperDownload(cfg, w, apigenWithPathParams(r, []string{"path"}, &pathValues))
+	case 5: // /shop/account
+		node.wrapperAccount(cfg, w, r)
+	case 6: // /shop/account/balance
+		node.wrapperBalance(cfg, w, r)
+	case 7: // /shop/account/history
+		node.wrapperHistory(cfg, w, r)
+	case 8: // /shop/orders
+		node.wrapperOrder(cfg, w, r)
+	case 9: // /shop/search
+		node.wrapperSearch(cfg, w, r)
+	case 10: // /shop/quote
+		node.wrapperQuote(cfg, w, r)
+	case 11: // /shop/checkout
+		node.wrapperCheckout(cfg, w, r)
+	case 12: // /shop/carts/{id}/items
+		node.wrapperAddToCart(cfg, w, apigenWithPathParams(r, []string{"id"}, &pathValues))
+	case 13: // /shop/items/{id}/photo
+		node.wrapperPhoto(cfg, w, apigenWithPathParams(r, []string{"id"}, &pathValues))
+	case 14: // /shop/hooks/payment
+		node.wrapperPayment(cfg, w, r)
+	default:
+		if cfg.NotFound != nil {
+			cfg.NotFound.ServeHTTP(w, r)
+			return
+		}
+		cfg.writeError(w, r, http.StatusNotFound, errors.New("unknown method"))
 	}
-	
-	paramAgeInt, _ := strconv.Atoi(paramAge)
-	params := CreateParams{
-		Login: paramLogin,
-		Name: paramName,
-		Status: paramStatus,
-		Age: paramAgeInt,
+}
+
+// Routes of ShopApi for any router
+func (node *ShopApi) Routes() []Route {
+	cfg := &DefaultHandlerConfig
+	return []Route{
+		{
+			Method:      "GET",
+			Pattern:     "/shop/public",
+			Handler:     func(w http.ResponseWriter, r *http.Request) { node.wrapperPublic(cfg, w, r) },
+			Service:     "ShopApi",
+			Name:        "Public",
+			Auth:        false,
+			AuthScheme:  "",
+			ParamStruct: "ItemParams",
+			Params: []RouteParam{
+				{Name: "id", In: ""},
+			},
+		},
+		{
+			Method:      "GET",
+			Pattern:     "/shop/items/{id}",
+			Handler:     func(w http.ResponseWriter, r *http.Request) { node.wrapperItem(cfg, w, r) },
+			Service:     "ShopApi",
+			Name:        "Item",
+			Auth:        false,
+			AuthScheme:  "",
+			ParamStruct: "ItemParams",
+			Params: []RouteParam{
+				{Name: "id", In: "path"},
+			},
+		},
+		{
+			Method:      "GET",
+			Pattern:     "/shop/items/featured",
+			Handler:     func(w http.ResponseWriter, r *http.Request) { node.wrapperFeatured(cfg, w, r) },
+			Service:     "ShopApi",
+			Name:        "Featured",
+			Auth:        false,
+			AuthScheme:  "",
+			ParamStruct: "FeaturedParams",
+			Params:      []RouteParam{},
+		},
+		{
+			Method:      "GET",
+			Pattern:     "/shop/files/{path...}",
+			Handler:     func(w http.ResponseWriter, r *http.Request) { node.wrapperDownload(cfg, w, r) },
+			Service:     "ShopApi",
+			Name:        "Download",
+			Auth:        false,
+			AuthScheme:  "",
+			ParamStruct: "DownloadParams",
+			Params: []RouteParam{
+				{Name: "path", In: "path"},
+			},
+		},
+		{
+			Method:      "GET",
+			Pattern:     "/shop/account",
+			Handler:     func(w http.ResponseWriter, r *http.Request) { node.wrapperAccount(cfg, w, r) },
+			Service:     "ShopApi",
+			Name:        "Account",
+			Auth:        true,
+			AuthScheme:  "basic",
+			ParamStruct: "AccountParams",
+			Params: []RouteParam{
+				{Name: "currency", In: ""},
+			},
+		},
+		{
+			Method:      "GET",
+			Pattern:     "/shop/account/balance",
+			Handler:     func(w http.ResponseWriter, r *http.Request) { node.wrapperBalance(cfg, w, r) },
+			Service:     "ShopApi",
+			Name:        "Balance",
+			Auth:        true,
+			AuthScheme:  "query",
+			ParamStruct: "AccountParams",
+			Params: []RouteParam{
+				{Name: "currency", In: ""},
+			},
+		},
+		{
+			Method:      "GET",
+			Pattern:     "/shop/account/history",
+			Handler:     func(w http.ResponseWriter, r *http.Request) { node.wrapperHistory(cfg, w, r) },
+			Service:     "ShopApi",
+			Name:        "History",
+			Auth:        true,
+			AuthScheme:  "cookie",
+			ParamStruct: "AccountParams",
+			Params: []RouteParam{
+				{Name: "currency", In: ""},
+			},
+		},
+		{
+			Method:      "POST",
+			Pattern:     "/shop/orders",
+			Handler:     func(w http.ResponseWriter, r *http.Request) { node.wrapperOrder(cfg, w, r) },
+			Service:     "ShopApi",
+			Name:        "Order",
+			Auth:        false,
+			AuthScheme:  "",
+			ParamStruct: "OrderParams",
+			Params: []RouteParam{
+				{Name: "item", In: ""},
+				{Name: "count", In: ""},
+			},
+		},
+		{
+			Method:      "GET",
+			Pattern:     "/shop/search",
+			Handler:     func(w http.ResponseWriter, r *http.Request) { node.wrapperSearch(cfg, w, r) },
+			Service:     "ShopApi",
+			Name:        "Search",
+			Auth:        false,
+			AuthScheme:  "",
+			ParamStruct: "SearchParams",
+			Params: []RouteParam{
+				{Name: "q", In: ""},
+			},
+		},
+		{
+			Method:      "GET",
+			Pattern:     "/shop/quote",
+			Handler:     func(w http.ResponseWriter, r *http.Request) { node.wrapperQuote(cfg, w, r) },
+			Service:     "ShopApi",
+			Name:        "Quote",
+			Auth:        false,
+			AuthScheme:  "",
+			ParamStruct: "QuoteParams",
+			Params: []RouteParam{
+				{Name: "item", In: ""},
+				{Name: "wait", In: ""},
+			},
+		},
+		{
+			Method:      "POST",
+			Pattern:     "/shop/checkout",
+			Handler:     func(w http.ResponseWriter, r *http.Request) { node.wrapperCheckout(cfg, w, r) },
+			Service:     "ShopApi",
+			Name:        "Checkout",
+			Auth:        false,
+			AuthScheme:  "",
+			ParamStruct: "OrderParams",
+			Params: []RouteParam{
+				{Name: "item", In: ""},
+				{Name: "count", In: ""},
+			},
+		},
+		{
+			Method:      "POST",
+			Pattern:     "/shop/carts/{id}/items",
+			Handler:     func(w http.ResponseWriter, r *http.Request) { node.wrapperAddToCart(cfg, w, r) },
+			Service:     "ShopApi",
+			Name:        "AddToCart",
+			Auth:        false,
+			AuthScheme:  "",
+			ParamStruct: "CartParams",
+			Params: []RouteParam{
+				{Name: "id", In: "path"},
+				{Name: "item", In: "body"},
+				{Name: "coupon", In: "query"},
+				{Name: "session", In: "cookie"},
+				{Name: "X-Client-Version", In: "header"},
+			},
+		},
+		{
+			Method:      "POST",
+			Pattern:     "/shop/items/{id}/photo",
+			Handler:     func(w http.ResponseWriter, r *http.Request) { node.wrapperPhoto(cfg, w, r) },
+			Service:     "ShopApi",
+			Name:        "Photo",
+			Auth:        false,
+			AuthScheme:  "",
+			ParamStruct: "PhotoParams",
+			Params: []RouteParam{
+				{Name: "id", In: "path"},
+				{Name: "photo", In: "body"},
+				{Name: "thumbs", In: "body"},
+			},
+		},
+		{
+			Method:      "POST",
+			Pattern:     "/shop/hooks/payment",
+			Handler:     func(w http.ResponseWriter, r *http.Request) { node.wrapperPayment(cfg, w, r) },
+			Service:     "ShopApi",
+			Name:        "Payment",
+			Auth:        false,
+			AuthScheme:  "",
+			ParamStruct: "PaymentParams",
+			Params: []RouteParam{
+				{Name: "order", In: ""},
+				{Name: "status", In: ""},
+			},
+		},
 	}
-	ctx := r.Context()
-	response, err := node.Create(ctx, params)
+}
+
+// ...
+// generated for type: AdminApi
+// ...
+
+// AdminApiService is what generated handlers need from AdminApi
+type AdminApiService interface {
+	Stats(ctx context.Context, in StatsParams) (*Stats, error)
+	Reindex(ctx context.Context, in StatsParams) (*Stats, error)
+	Report(ctx context.Context, in StatsParams) (*Stats, error)
+	Crash(ctx context.Context, in StatsParams) (*Stats, error)
+}
+
+var _ AdminApiService = (*AdminApi)(nil)
+
+// middleware chain and concurrency limit of AdminApi.Stats
+var apigenChainAdminApiStats = &apigenChainSpec{
+	service: "AdminApi",
+	names:   []string{"audit"},
+	handler: func(cfg *HandlerConfig) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Context().Value(apigenNodeKey{}).(*AdminApi).handleStats(cfg, w, r)
+		})
+	},
+}
+
+// main.methodOptions{URL:"/admin/stats", Auth:true, AuthScheme:"header", Method:"GET", Signature:main.signatureOptions{Header:"", Algo:"", TimestampHeader:"", Window:0}, Middleware:[]string{"audit"}, RateLimit:main.rateLimitOptions{RPS:0, Burst:0, Key:""}, Timeout:0, MaxConcurrency:0, QueueWait:0, CORS:main.corsOptions{Origins:[]string(nil), Methods:[]string(nil), Headers:[]string(nil), ExposeHeaders:[]string(nil), Credentials:false, MaxAge:0}, MaxBody:0}
+// [Wrapper for AdminApi] method: Stats
+func (node *AdminApi) wrapperStats(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	sw := &apigenStatusWriter{ResponseWriter: w}
+	w = sw
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	defer cfg.logAccess(sw, r, "/admin/stats", "Stats", time.Now())
+	defer cfg.Metrics.start("/admin/stats", "Stats").done(sw, time.Now())
+	if cfg.Tracer != nil {
+		var span Span
+		r, span = cfg.startSpan(r, "AdminApi.Stats", "/admin/stats")
+		defer apigenEndSpan(span, sw)
+	}
+	if !cfg.DisableRecovery {
+		defer cfg.recoverPanic(w, r, "Stats")
+	}
+
+	// CORS, preflights are answered here
+	if cfg.handleCORS(w, r, nil, "GET") {
+		return
+	}
+
+	// Body limit, bodies known to be too large are rejected before reading
+	if bodyLimit := cfg.MaxBodySize; bodyLimit > 0 {
+		if r.ContentLength > bodyLimit {
+			cfg.writeError(w, r, http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+	}
+
+	// Authorization checker (header)
+	authCred := AuthCredential{Scheme: "header", Token: r.Header.Get("X-Auth")}
+	if !cfg.AuthVerifier(r, authCred) {
+		cfg.writeError(w, r, http.StatusForbidden, errors.New("unauthorized"))
+		return
+	}
+
+	// Method checker
+	if r.Method != http.MethodGet {
+		cfg.writeError(w, r, http.StatusNotAcceptable, errors.New("bad method"))
+		return
+	}
+
+	// Middlewares run after the checks, before binding params
+	cfg.chain(apigenChainAdminApiStats).handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apigenNodeKey{}, node)))
+}
+
+// [Handler for AdminApi] method: Stats, binds params and calls the method
+func (node *AdminApi) handleStats(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	// validation StatsParams
+	values, ok := cfg.bindValues(w, r, []string{"period"})
+	if !ok {
+		return
+	}
+	if r.MultipartForm != nil {
+		// net/http removes temp files of the request it made, not of r made by WithContext
+		defer r.MultipartForm.RemoveAll()
+	}
+	paramPeriod := values.Get("period")
+	// tplDefault
+	if paramPeriod == "" {
+		paramPeriod = "day"
+	}
+
+	// tplEnum
+	enumFlag := false
+	if paramPeriod == "day" {
+		enumFlag = true
+	}
+	if paramPeriod == "week" {
+		enumFlag = true
+	}
+	if !enumFlag {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("period must be one of [day, week]"))
+		return
+	}
+
+	params := StatsParams{
+		Period: paramPeriod,
+	}
+	ctx, cancel := cfg.methodContext(r, 0)
+	defer cancel()
+	response, err := node.Stats(ctx, params)
 	if err != nil {
 		switch err.(type) {
 		case ApiError:
-			data, _ := json.Marshal(resValue{"error": err.(ApiError).Err.Error()})
-			w.WriteHeader(err.(ApiError).HTTPStatus)
-			io.WriteString(w, string(data))
+			cfg.writeError(w, r, err.(ApiError).HTTPStatus, err)
 		default:
-			data, _ := json.Marshal(resValue{"error": err.Error()})
-			w.WriteHeader(http.StatusInternalServerError)
-			io.WriteString(w, string(data))
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+				cfg.writeError(w, r, http.StatusGatewayTimeout, errors.New("timeout"))
+				return
+			}
+			cfg.Logger.Error("method failed", "method", "Stats", "request_id", RequestIDFromContext(ctx), "error", err)
+			cfg.writeError(w, r, http.StatusInternalServerError, err)
 		}
 		return
 	}
-	data, _ := json.Marshal(resValue{"error": "", "response": response})
+	data, _ := json.Marshal(apigenResValue{"error": "", "response": response})
 	w.WriteHeader(http.StatusOK)
-	io.WriteString(w, string(data))	
+	io.WriteString(w, string(data))
 }
 
-// ServeHTTP for MyApi
-func (node *MyApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.URL.Path {
-	case "/user/profile":
-		node.wrapperProfile(w, r)
-	case "/user/create":
-		node.wrapperCreate(w, r)
-	default:
-		w.WriteHeader(http.StatusNotFound)
-		data, _ := json.Marshal(resValue{"error": "unknown method"})
-		io.WriteString(w, string(data))
-	}
+// middleware chain and concurrency limit of AdminApi.Reindex
+var apigenChainAdminApiReindex = &apigenChainSpec{
+	service: "AdminApi",
+	names:   []string{"confirm"},
+	handler: func(cfg *HandlerConfig) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Context().Value(apigenNodeKey{}).(*AdminApi).handleReindex(cfg, w, r)
+		})
+	},
 }
 
-// ...
-// generated for type: OtherApi
-// ...
+// main.methodOptions{URL:"/admin/reindex", Auth:true, AuthScheme:"header", Method:"POST", Signature:main.signatureOptions{Header:"", Algo:"", TimestampHeader:"", Window:0}, Middleware:[]string{"confirm"}, RateLimit:main.rateLimitOptions{RPS:0, Burst:0, Key:""}, Timeout:0, MaxConcurrency:0, QueueWait:0, CORS:main.corsOptions{Origins:[]string(nil), Methods:[]string(nil), Headers:[]string(nil), ExposeHeaders:[]string(nil), Credentials:false, MaxAge:0}, MaxBody:0}
+// [Wrapper for AdminApi] method: Reindex
+func (node *AdminApi) wrapperReindex(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	sw := &apigenStatusWriter{ResponseWriter: w}
+	w = sw
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	defer cfg.logAccess(sw, r, "/admin/reindex", "Reindex", time.Now())
+	defer cfg.Metrics.start("/admin/reindex", "Reindex").done(sw, time.Now())
+	if cfg.Tracer != nil {
+		var span Span
+		r, span = cfg.startSpan(r, "AdminApi.Reindex", "/admin/reindex")
+		defer apigenEndSpan(span, sw)
+	}
+	if !cfg.DisableRecovery {
+		defer cfg.recoverPanic(w, r, "Reindex")
+	}
 
-// main.methodOptions{URL:"/user/create", Auth:true, Method:"POST"}
-// [Wrapper for OtherApi] method: Create
-func (node *OtherApi) wrapperCreate(w http.ResponseWriter, r *http.Request) {
-	// Authorization checker	
-	authGood := "100500"
-	auth := r.Header.Get("X-Auth")
-	if auth != authGood {
-		w.WriteHeader(http.StatusForbidden)
-		data, _ := json.Marshal(resValue{"error": "unauthorized"})
-		io.WriteString(w, string(data))
+	// CORS, preflights are answered here
+	if cfg.handleCORS(w, r, nil, "POST") {
+		return
+	}
+
+	// Body limit, bodies known to be too large are rejected before reading
+	if bodyLimit := cfg.MaxBodySize; bodyLimit > 0 {
+		if r.ContentLength > bodyLimit {
+			cfg.writeError(w, r, http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+	}
+
+	// Authorization checker (header)
+	authCred := AuthCredential{Scheme: "header", Token: r.Header.Get("X-Auth")}
+	if !cfg.AuthVerifier(r, authCred) {
+		cfg.writeError(w, r, http.StatusForbidden, errors.New("unauthorized"))
 		return
-	} 	
+	}
 
 	// Method checker
 	if r.Method != http.MethodPost {
-		w.WriteHeader(http.StatusNotAcceptable)
-		data, _ := json.Marshal(resValue{"error": "bad method"})
-		io.WriteString(w, string(data))	
+		cfg.writeError(w, r, http.StatusNotAcceptable, errors.New("bad method"))
 		return
 	}
 
-	// validation OtherCreateParams
-	r.ParseForm()
-	paramUsername := r.Form.Get("username")
-	// tplRequired
-	if paramUsername == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		data, _ := json.Marshal(resValue{"error": "username must me not empty"})
-		io.WriteString(w, string(data))
+	// Middlewares run after the checks, before binding params
+	cfg.chain(apigenChainAdminApiReindex).handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apigenNodeKey{}, node)))
+}
+
+// [Handler for AdminApi] method: Reindex, binds params and calls the method
+func (node *AdminApi) handleReindex(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	// validation StatsParams
+	values, ok := cfg.bindValues(w, r, []string{"period"})
+	if !ok {
 		return
 	}
-
-	// tplMin
-	if len([]rune(paramUsername)) < 3 {
-		w.WriteHeader(http.StatusBadRequest)
-		data, _ := json.Marshal(resValue{"error": "username len must be >= 3"})
-		io.WriteString(w, string(data))
-		return 
-	}
-	
-	paramName := r.Form.Get("account_name")
-	paramClass := r.Form.Get("class")
-	// tplDefault	
-	if paramClass == "" {
-		paramClass = "warrior"
+	if r.MultipartForm != nil {
+		// net/http removes temp files of the request it made, not of r made by WithContext
+		defer r.MultipartForm.RemoveAll()
+	}
+	paramPeriod := values.Get("period")
+	// tplDefault
+	if paramPeriod == "" {
+		paramPeriod = "day"
 	}
 
 	// tplEnum
-	enumFlag := false	
-	if paramClass == "warrior" {
+	enumFlag := false
+	if paramPeriod == "day" {
 		enumFlag = true
 	}
-	if paramClass == "sorcerer" {
+	if paramPeriod == "week" {
 		enumFlag = true
 	}
-	if paramClass == "rouge" {
+	if !enumFlag {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("period must be one of [day, week]"))
+		return
+	}
+
+	params := StatsParams{
+		Period: paramPeriod,
+	}
+	ctx, cancel := cfg.methodContext(r, 0)
+	defer cancel()
+	response, err := node.Reindex(ctx, params)
+	if err != nil {
+		switch err.(type) {
+		case ApiError:
+			cfg.writeError(w, r, err.(ApiError).HTTPStatus, err)
+		default:
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+				cfg.writeError(w, r, http.StatusGatewayTimeout, errors.New("timeout"))
+				return
+			}
+			cfg.Logger.Error("method failed", "method", "Reindex", "request_id", RequestIDFromContext(ctx), "error", err)
+			cfg.writeError(w, r, http.StatusInternalServerError, err)
+		}
+		return
+	}
+	data, _ := json.Marshal(apigenResValue{"error": "", "response": response})
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(data))
+}
+
+// middleware chain and concurrency limit of AdminApi.Report
+var apigenChainAdminApiReport = &apigenChainSpec{
+	service: "AdminApi",
+	names:   []string{"audit"},
+	handler: func(cfg *HandlerConfig) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Context().Value(apigenNodeKey{}).(*AdminApi).handleReport(cfg, w, r)
+		})
+	},
+}
+
+// main.methodOptions{URL:"/admin/report", Auth:true, AuthScheme:"header", Method:"GET", Signature:main.signatureOptions{Header:"", Algo:"", TimestampHeader:"", Window:0}, Middleware:[]string{"audit"}, RateLimit:main.rateLimitOptions{RPS:1, Burst:1, Key:"principal"}, Timeout:0, MaxConcurrency:0, QueueWait:0, CORS:main.corsOptions{Origins:[]string(nil), Methods:[]string(nil), Headers:[]string(nil), ExposeHeaders:[]string(nil), Credentials:false, MaxAge:0}, MaxBody:0}
+// [Wrapper for AdminApi] method: Report
+func (node *AdminApi) wrapperReport(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	sw := &apigenStatusWriter{ResponseWriter: w}
+	w = sw
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	defer cfg.logAccess(sw, r, "/admin/report", "Report", time.Now())
+	defer cfg.Metrics.start("/admin/report", "Report").done(sw, time.Now())
+	if cfg.Tracer != nil {
+		var span Span
+		r, span = cfg.startSpan(r, "AdminApi.Report", "/admin/report")
+		defer apigenEndSpan(span, sw)
+	}
+	if !cfg.DisableRecovery {
+		defer cfg.recoverPanic(w, r, "Report")
+	}
+
+	// CORS, preflights are answered here
+	if cfg.handleCORS(w, r, nil, "GET") {
+		return
+	}
+
+	// Body limit, bodies known to be too large are rejected before reading
+	if bodyLimit := cfg.MaxBodySize; bodyLimit > 0 {
+		if r.ContentLength > bodyLimit {
+			cfg.writeError(w, r, http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+	}
+
+	// Authorization checker (header)
+	authCred := AuthCredential{Scheme: "header", Token: r.Header.Get("X-Auth")}
+	if !cfg.AuthVerifier(r, authCred) {
+		cfg.writeError(w, r, http.StatusForbidden, errors.New("unauthorized"))
+		return
+	}
+
+	// Method checker
+	if r.Method != http.MethodGet {
+		cfg.writeError(w, r, http.StatusNotAcceptable, errors.New("bad method"))
+		return
+	}
+
+	// Rate limit (1 rps, burst 1 by principal)
+	if cfg.RateLimitStore != nil {
+		rateKey := apigenSecretKey(authCred.Token)
+		if ok, retryAfter := cfg.RateLimitStore.Allow("AdminApi.Report:"+rateKey, 1, 1, time.Now()); !ok {
+			cfg.rateLimited(w, r, retryAfter)
+			return
+		}
+	}
+
+	// Middlewares run after the checks, before binding params
+	cfg.chain(apigenChainAdminApiReport).handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apigenNodeKey{}, node)))
+}
+
+// [Handler for AdminApi] method: Report, binds params and calls the method
+func (node *AdminApi) handleReport(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	// validation StatsParams
+	values, ok := cfg.bindValues(w, r, []string{"period"})
+	if !ok {
+		return
+	}
+	if r.MultipartForm != nil {
+		// net/http removes temp files of the request it made, not of r made by WithContext
+		defer r.MultipartForm.RemoveAll()
+	}
+	paramPeriod := values.Get("period")
+	// tplDefault
+	if paramPeriod == "" {
+		paramPeriod = "day"
+	}
+
+	// tplEnum
+	enumFlag := false
+	if paramPeriod == "day" {
+		enumFlag = true
+	}
+	if paramPeriod == "week" {
 		enumFlag = true
 	}
 	if !enumFlag {
-		w.WriteHeader(http.StatusBadRequest)
-		data, _ := json.Marshal(resValue{"error": "class must be one of [warrior, sorcerer, rouge]"})
-		io.WriteString(w, string(data))
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("period must be one of [day, week]"))
 		return
 	}
 
-	paramLevel := r.Form.Get("level")
-	// tplMin
-	paramLevelIntMin, err := strconv.Atoi(paramLevel)
+	params := StatsParams{
+		Period: paramPeriod,
+	}
+	ctx, cancel := cfg.methodContext(r, 0)
+	defer cancel()
+	response, err := node.Report(ctx, params)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		data, _ := json.Marshal(resValue{"error": "level must be int"})
-		io.WriteString(w, string(data))
+		switch err.(type) {
+		case ApiError:
+			cfg.writeError(w, r, err.(ApiError).HTTPStatus, err)
+		default:
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+				cfg.writeError(w, r, http.StatusGatewayTimeout, errors.New("timeout"))
+				return
+			}
+			cfg.Logger.Error("method failed", "method", "Report", "request_id", RequestIDFromContext(ctx), "error", err)
+			cfg.writeError(w, r, http.StatusInternalServerError, err)
+		}
 		return
 	}
-	if paramLevelIntMin < 1 {
-		w.WriteHeader(http.StatusBadRequest)
-		data, _ := json.Marshal(resValue{"error": "level must be >= 1"})
-		io.WriteString(w, string(data))
-		return 
+	data, _ := json.Marshal(apigenResValue{"error": "", "response": response})
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, string(data))
+}
+
+// middleware chain and concurrency limit of AdminApi.Crash
+var apigenChainAdminApiCrash = &apigenChainSpec{
+	service: "AdminApi",
+	names:   []string{"audit"},
+	handler: func(cfg *HandlerConfig) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Context().Value(apigenNodeKey{}).(*AdminApi).handleCrash(cfg, w, r)
+		})
+	},
+}
+
+// main.methodOptions{URL:"/admin/crash", Auth:true, AuthScheme:"header", Method:"POST", Signature:main.signatureOptions{Header:"", Algo:"", TimestampHeader:"", Window:0}, Middleware:[]string{"audit"}, RateLimit:main.rateLimitOptions{RPS:0, Burst:0, Key:""}, Timeout:0, MaxConcurrency:0, QueueWait:0, CORS:main.corsOptions{Origins:[]string(nil), Methods:[]string(nil), Headers:[]string(nil), ExposeHeaders:[]string(nil), Credentials:false, MaxAge:0}, MaxBody:0}
+// [Wrapper for AdminApi] method: Crash
+func (node *AdminApi) wrapperCrash(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	sw := &apigenStatusWriter{ResponseWriter: w}
+	w = sw
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
 	}
-	
-	// tplMax
-	paramLevelIntMax, err := strconv.Atoi(paramLevel)
-	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		data, _ := json.Marshal(resValue{"error": "level must be int"})
-		io.WriteString(w, string(data))
+	defer cfg.logAccess(sw, r, "/admin/crash", "Crash", time.Now())
+	defer cfg.Metrics.start("/admin/crash", "Crash").done(sw, time.Now())
+	if cfg.Tracer != nil {
+		var span Span
+		r, span = cfg.startSpan(r, "AdminApi.Crash", "/admin/crash")
+		defer apigenEndSpan(span, sw)
+	}
+	if !cfg.DisableRecovery {
+		defer cfg.recoverPanic(w, r, "Crash")
+	}
+
+	// CORS, preflights are answered here
+	if cfg.handleCORS(w, r, nil, "POST") {
 		return
 	}
-	if paramLevelIntMax > 50 {
-		w.WriteHeader(http.StatusBadRequest)
-		data, _ := json.Marshal(resValue{"error": "level must be <= 50"})
-		io.WriteString(w, string(data))
-		return 
+
+	// Body limit, bodies known to be too large are rejected before reading
+	if bodyLimit := cfg.MaxBodySize; bodyLimit > 0 {
+		if r.ContentLength > bodyLimit {
+			cfg.writeError(w, r, http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
 	}
-	
-	paramLevelInt, _ := strconv.Atoi(paramLevel)
-	params := OtherCreateParams{
-		Username: paramUsername,
-		Name: paramName,
-		Class: paramClass,
-		Level: paramLevelInt,
+
+	// Authorization checker (header)
+	authCred := AuthCredential{Scheme: "header", Token: r.Header.Get("X-Auth")}
+	if !cfg.AuthVerifier(r, authCred) {
+		cfg.writeError(w, r, http.StatusForbidden, errors.New("unauthorized"))
+		return
 	}
-	ctx := r.Context()
-	response, err := node.Create(ctx, params)
+
+	// Method checker
+	if r.Method != http.MethodPost {
+		cfg.writeError(w, r, http.StatusNotAcceptable, errors.New("bad method"))
+		return
+	}
+
+	// Middlewares run after the checks, before binding params
+	cfg.chain(apigenChainAdminApiCrash).handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apigenNodeKey{}, node)))
+}
+
+// [Handler for AdminApi] method: Crash, binds params and calls the method
+func (node *AdminApi) handleCrash(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	// validation StatsParams
+	values, ok := cfg.bindValues(w, r, []string{"period"})
+	if !ok {
+		return
+	}
+	if r.MultipartForm != nil {
+		// net/http removes temp files of the request it made, not of r made by WithContext
+		defer r.MultipartForm.RemoveAll()
+	}
+	paramPeriod := values.Get("period")
+	// tplDefault
+	if paramPeriod == "" {
+		paramPeriod = "day"
+	}
+
+	// tplEnum
+	enumFlag := false
+	if paramPeriod == "day" {
+		enumFlag = true
+	}
+	if paramPeriod == "week" {
+		enumFlag = true
+	}
+	if !enumFlag {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("period must be one of [day, week]"))
+		return
+	}
+
+	params := StatsParams{
+		Period: paramPeriod,
+	}
+	ctx, cancel := cfg.methodContext(r, 0)
+	defer cancel()
+	response, err := node.Crash(ctx, params)
 	if err != nil {
 		switch err.(type) {
 		case ApiError:
-			data, _ := json.Marshal(resValue{"error": err.(ApiError).Err.Error()})
-			w.WriteHeader(err.(ApiError).HTTPStatus)
-			io.WriteString(w, string(data))
+			cfg.writeError(w, r, err.(ApiError).HTTPStatus, err)
 		default:
-			data, _ := json.Marshal(resValue{"error": err.Error()})
-			w.WriteHeader(http.StatusInternalServerError)
-			io.WriteString(w, string(data))
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+				cfg.writeError(w, r, http.StatusGatewayTimeout, errors.New("timeout"))
+				return
+			}
+			cfg.Logger.Error("method failed", "method", "Crash", "request_id", RequestIDFromContext(ctx), "error", err)
+			cfg.writeError(w, r, http.StatusInternalServerError, err)
 		}
 		return
 	}
-	data, _ := json.Marshal(resValue{"error": "", "response": response})
+	data, _ := json.Marshal(apigenResValue{"error": "", "response": response})
 	w.WriteHeader(http.StatusOK)
-	io.WriteString(w, string(data))	
+	io.WriteString(w, string(data))
 }
 
-// ServeHTTP for OtherApi
-func (node *OtherApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	switch r.URL.Path {
-	case "/user/create":
-		node.wrapperCreate(w, r)
+// middleware chains of AdminApi built by constructors
+var apigenChainsAdminApi = []*apigenChainSpec{apigenChainAdminApiStats, apigenChainAdminApiReindex, apigenChainAdminApiReport, apigenChainAdminApiCrash}
+
+// routes of AdminApi
+var apigenRoutesAdminApi = &apigenRouteNode{static: map[string]*apigenRouteNode{
+	"admin": {static: map[string]*apigenRouteNode{
+		"crash":   {route: 4},
+		"reindex": {route: 2},
+		"report":  {route: 3},
+		"stats":   {route: 1},
+	}},
+}}
+
+// ServeHTTP for AdminApi
+func (node *AdminApi) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	cfg := &DefaultHandlerConfig
+	// before routing, so redirects, 404 and 406 carry the ID too
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	var pathValues [apigenMaxPathParams]string
+	route, handled := apigenRouteRequest(apigenRoutesAdminApi, w, r, &pathValues)
+	if handled {
+		return
+	}
+	switch route {
+	case 1: // /admin/stats
+		node.wrapperStats(cfg, w, r)
+	case 2: // /admin/reindex
+		node.wrapperReindex(cfg, w, r)
+	case 3: // /admin/report
+		node.wrapperReport(cfg, w, r)
+	case 4: // /admin/crash
+		node.wrapperCrash(cfg, w, r)
 	default:
-		w.WriteHeader(http.StatusNotFound)
-		data, _ := json.Marshal(resValue{"error": "unknown method"})
-		io.WriteString(w, string(data))
+		if cfg.NotFound != nil {
+			cfg.NotFound.ServeHTTP(w, r)
+			return
+		}
+		cfg.writeError(w, r, http.StatusNotFound, errors.New("unknown method"))
+	}
+}
+
+// Routes of AdminApi for any router
+func (node *AdminApi) Routes() []Route {
+	cfg := &DefaultHandlerConfig
+	return []Route{
+		{
+			Method:      "GET",
+			Pattern:     "/admin/stats",
+			Handler:     func(w http.ResponseWriter, r *http.Request) { node.wrapperStats(cfg, w, r) },
+			Service:     "AdminApi",
+			Name:        "Stats",
+			Auth:        true,
+			AuthScheme:  "header",
+			ParamStruct: "StatsParams",
+			Params: []RouteParam{
+				{Name: "period", In: ""},
+			},
+		},
+		{
+			Method:      "POST",
+			Pattern:     "/admin/reindex",
+			Handler:     func(w http.ResponseWriter, r *http.Request) { node.wrapperReindex(cfg, w, r) },
+			Service:     "AdminApi",
+			Name:        "Reindex",
+			Auth:        true,
+			AuthScheme:  "header",
+			ParamStruct: "StatsParams",
+			Params: []RouteParam{
+				{Name: "period", In: ""},
+			},
+		},
+		{
+			Method:      "GET",
+			Pattern:     "/admin/report",
+			Handler:     func(w http.ResponseWriter, r *http.Request) { node.wrapperReport(cfg, w, r) },
+			Service:     "AdminApi",
+			Name:        "Report",
+			Auth:        true,
+			AuthScheme:  "header",
+			ParamStruct: "StatsParams",
+			Params: []RouteParam{
+				{Name: "period", In: ""},
+			},
+		},
+		{
+			Method:      "POST",
+			Pattern:     "/admin/crash",
+			Handler:     func(w http.ResponseWriter, r *http.Request) { node.wrapperCrash(cfg, w, r) },
+			Service:     "AdminApi",
+			Name:        "Crash",
+			Auth:        true,
+			AuthScheme:  "header",
+			ParamStruct: "StatsParams",
+			Params: []RouteParam{
+				{Name: "period", In: ""},
+			},
+		},
 	}
 }
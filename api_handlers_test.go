@@ -0,0 +1,55 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+// withConfig makes DefaultHandlerConfig from opts for the test
+func withConfig(t *testing.T, opts ...HandlerOption) {
+	cfg := DefaultHandlerConfig
+	DefaultHandlerConfig = NewHandlerConfig(opts...)
+	t.Cleanup(func() { DefaultHandlerConfig = cfg })
+}
+
+func TestRouting(t *testing.T) {
+	withConfig(t)
+	cases := []struct {
+		method   string
+		path     string
+		status   int
+		body     string
+		location string
+	}{
+		{"GET", "/shop/items/7", 200, `"id":"7"`, ""},
+		{"GET", "/shop/items/new", 200, `"id":"new"`, ""},
+		{"GET", "/shop/items/featured", 200, `"id":"featured"`, ""},
+		{"GET", "/shop/items/featured/photo", 406, "bad method", ""},
+		{"GET", "/shop/files/a/b/c.txt", 200, `"id":"a/b/c.txt"`, ""},
+		{"GET", "/shop/files/", 400, "path must me not empty", ""},
+		{"POST", "/shop/items/7", 406, "bad method", ""},
+		{"GET", "/shop/public?id=3", 200, `"id":"3"`, ""},
+		{"GET", "/shop/items/7/photo", 406, "bad method", ""},
+		{"GET", "/shop/items", 404, "unknown method", ""},
+		{"GET", "/items/7", 404, "unknown method", ""},
+		// not clean paths and wrong trailing slashes
+		{"GET", "/shop/items/7/", 301, "", "/shop/items/7"},
+		{"GET", "/shop/items/../items/7", 301, "", "/shop/items/7"},
+		{"GET", "/shop//public?id=3", 301, "", "/shop/public?id=3"},
+		{"POST", "/shop//orders", 308, "", "/shop/orders"},
+	}
+	for _, c := range cases {
+		w := serve(NewShopApi(), httptest.NewRequest(c.method, c.path, nil))
+		if w.Code != c.status || !strings.Contains(w.Body.String(), c.body) || w.Header().Get("Location") != c.location {
+			t.Errorf("%s %s: %d %s %q", c.method, c.path, w.Code, w.Body.String(), w.Header().Get("Location"))
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuthSchemes(t *testing.T) {
+	withConfig(t)
+	cases := []struct {
+		name   string
+		path   string
+		set    func(r *http.Request)
+		status int
+	}{
+		{"basic", "/shop/account", func(r *http.Request) { r.SetBasicAuth("rvasily", "100500") }, 200},
+		{"basic wrong password", "/shop/account", func(r *http.Request) { r.SetBasicAuth("rvasily", "123") }, 403},
+		{"basic in header", "/shop/account", func(r *http.Request) { r.Header.Set("X-Auth", "100500") }, 403},
+		{"query", "/shop/account/balance?api_key=100500", func(r *http.Request) {}, 200},
+		{"query wrong key", "/shop/account/balance?api_key=123", func(r *http.Request) {}, 403},
+		{"query in cookie", "/shop/account/balance", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "api_key", Value: "100500"}) }, 403},
+		{"cookie", "/shop/account/history", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "api_key", Value: "100500"}) }, 200},
+		{"cookie wrong key", "/shop/account/history", func(r *http.Request) { r.AddCookie(&http.Cookie{Name: "api_key", Value: "123"}) }, 403},
+		{"cookie in query", "/shop/account/history?api_key=100500", func(r *http.Request) {}, 403},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", c.path, nil)
+		c.set(r)
+		w := serve(NewShopApi(), r)
+		if w.Code != c.status {
+			t.Errorf("%s: %d %s", c.name, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestAuthHeaderScheme(t *testing.T) {
+	withConfig(t)
+	for key, status := range map[string]int{"100500": 200, "123": 403, "": 403} {
+		r := httptest.NewRequest("POST", "/user/create", strings.NewReader("login=mr.moderator&status=moderator&age=32"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("X-Auth", key)
+		if w := serve(NewMyApi(), r); w.Code != status {
+			t.Errorf("X-Auth %q: %d %s", key, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestAuthVerifier(t *testing.T) {
+	var got AuthCredential
+	withConfig(t, WithAuthVerifier(func(r *http.Request, cred AuthCredential) bool {
+		got = cred
+		return cred.User == "admin" && cred.Password == "secret"
+	}))
+	r := httptest.NewRequest("GET", "/shop/account", nil)
+	r.SetBasicAuth("admin", "secret")
+	if w := serve(NewShopApi(), r); w.Code != 200 {
+		t.Errorf("%d %s", w.Code, w.Body.String())
+	}
+	if want := (AuthCredential{Scheme: "basic", User: "admin", Password: "secret"}); got != want {
+		t.Errorf("verifier got %+v, want %+v", got, want)
+	}
+}
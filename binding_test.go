@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJSONBody(t *testing.T) {
+	withConfig(t, WithRateLimitStore(nil))
+	cases := []struct {
+		contentType string
+		body        string
+		status      int
+		want        string
+	}{
+		{"application/json", `{"item": "42", "count": 2}`, 200, `{"error":"","response":{"item":"42","count":2}}`},
+		{"application/json", `{"item": "42", "count": 11}`, 400, `count must be \u003c= 10`},
+		{"application/json", `{"count": 1}`, 400, "item must me not empty"},
+		// keys that are not params may hold anything
+		{"application/json", `{"item": "42", "count": 1, "meta": {"src": "app"}, "tags": ["a"]}`, 200, `"count":1`},
+		{"application/json", `{"item": {"id": "42"}, "count": 1}`, 400, "item must be a scalar"},
+		// scalars are bound as their text
+		{"application/json", `{"item": 42, "count": "2"}`, 200, `{"item":"42","count":2}`},
+		{"application/json", `{"item": true, "count": 1}`, 200, `{"item":"true","count":1}`},
+		{"application/json", `{"item": null, "count": 1}`, 400, "item must me not empty"},
+		{"application/json", `{"item": "42", "count": 1.5}`, 400, "count must be int"},
+		{"application/json", `["42", 1]`, 400, "bad json"},
+		{"application/json", `{"item": "42"`, 400, "bad json"},
+		{"application/json; charset=utf-8", `{"item": "42", "count": 1}`, 200, `"count":1`},
+		{"application/vnd.shop+json", `{"item": "42", "count": 1}`, 200, `"count":1`},
+		{"text/plain", `{"item": "42", "count": 1}`, 415, "unsupported content type"},
+		{"bad/type; =", `{"item": "42", "count": 1}`, 415, "unsupported content type"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("POST", "/shop/orders", strings.NewReader(c.body))
+		r.Header.Set("Content-Type", c.contentType)
+		w := serve(NewShopApi(), r)
+		if w.Code != c.status || !strings.Contains(w.Body.String(), c.want) {
+			t.Errorf("%s %s: %d %s", c.contentType, c.body, w.Code, w.Body.String())
+		}
+	}
+}
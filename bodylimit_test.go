@@ -0,0 +1,65 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyLimit(t *testing.T) {
+	withConfig(t, WithRateLimitStore(nil), WithMaxBodySize(64))
+	cases := []struct {
+		name     string
+		path     string
+		size     int
+		streamed bool
+		status   int
+	}{
+		{"max_body", "/shop/orders", 16 << 10, false, 200},
+		{"over max_body", "/shop/orders", 16<<10 + 1, false, 413},
+		// no Content-Length, the limit is found while reading
+		{"streamed over max_body", "/shop/orders", 17 << 10, true, 413},
+		{"streamed max_body", "/shop/orders", 16 << 10, true, 200},
+		{"WithMaxBodySize", "/shop/checkout", 64, false, 200},
+		{"over WithMaxBodySize", "/shop/checkout", 65, false, 413},
+		{"streamed over WithMaxBodySize", "/shop/checkout", 65, true, 413},
+	}
+	for _, c := range cases {
+		// the form is padded with an unknown field up to the size
+		body := "item=1&count=1&pad=" + strings.Repeat("a", c.size-len("item=1&count=1&pad="))
+		r := httptest.NewRequest("POST", c.path, strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if c.streamed {
+			r.Body = io.NopCloser(strings.NewReader(body))
+			r.ContentLength = -1
+		}
+		w := serve(NewShopApi(), r)
+		if w.Code != c.status || c.status == 413 && !strings.Contains(w.Body.String(), "request body too large") {
+			t.Errorf("%s: %d %s", c.name, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestBodyLimitOff(t *testing.T) {
+	withConfig(t, WithMaxBodySize(0))
+	// forms are limited by net/http anyway
+	r := httptest.NewRequest("POST", "/shop/checkout", strings.NewReader(`{"item": "1", "count": 1, "pad": "`+strings.Repeat("a", 11<<20)+`"}`))
+	r.Header.Set("Content-Type", "application/json")
+	if w := serve(NewShopApi(), r); w.Code != http.StatusOK {
+		t.Errorf("%d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestBodyLimitCORS(t *testing.T) {
+	withConfig(t)
+	r := httptest.NewRequest("POST", "/shop/orders", strings.NewReader(strings.Repeat("a", 17<<10)))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Origin", "https://shop.example")
+	w := serve(NewShopApi(), r)
+	// browsers read the error only with CORS headers
+	if w.Code != http.StatusRequestEntityTooLarge || w.Header().Get("Access-Control-Allow-Origin") != "https://shop.example" {
+		t.Errorf("%d %q %s", w.Code, w.Header().Get("Access-Control-Allow-Origin"), w.Body.String())
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestConcurrencyShed(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	metrics := NewMetrics()
+	// middlewares run inside the limit, this one holds the slot
+	withConfig(t, WithMetrics(metrics), WithMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Query().Get("hold") != "" {
+				entered <- struct{}{}
+				<-release
+			}
+			next.ServeHTTP(w, r)
+		})
+	}))
+	checkout := func(query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/shop/checkout"+query, strings.NewReader("item=42&count=1"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return serve(NewShopApi(), r)
+	}
+
+	held := make(chan *httptest.ResponseRecorder)
+	go func() { held <- checkout("?hold=1") }()
+	<-entered
+	if w := checkout(""); w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "1" ||
+		!strings.Contains(w.Body.String(), "overloaded") {
+		t.Errorf("over the limit: %d %q %s", w.Code, w.Header().Get("Retry-After"), w.Body.String())
+	}
+	close(release)
+	if w := <-held; w.Code != 200 {
+		t.Errorf("held: %d %s", w.Code, w.Body.String())
+	}
+	// the slot is back
+	if w := checkout(""); w.Code != 200 {
+		t.Errorf("after release: %d %s", w.Code, w.Body.String())
+	}
+
+	w := serve(metrics, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `apigen_requests_shed_total{route="/shop/checkout",method="Checkout"} 1`+"\n") {
+		t.Errorf("shed requests are not counted:\n%s", w.Body.String())
+	}
+}
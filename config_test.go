@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestErrorEncoder(t *testing.T) {
+	withConfig(t, WithErrorEncoder(func(w http.ResponseWriter, r *http.Request, status int, err error) {
+		w.WriteHeader(status)
+		w.Write([]byte("custom: " + err.Error()))
+	}))
+	w := serve(NewMyApi(), httptest.NewRequest("GET", "/user/profile", nil))
+	if w.Code != 400 || w.Body.String() != "custom: login must me not empty" {
+		t.Errorf("%d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	withConfig(t, WithNotFound(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})))
+	if w := serve(NewMyApi(), httptest.NewRequest("GET", "/user/unknown", nil)); w.Code != http.StatusTeapot {
+		t.Errorf("%d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestLogger(t *testing.T) {
+	logs := &bytes.Buffer{}
+	withConfig(t, WithLogger(slog.New(slog.NewTextHandler(logs, nil))))
+	w := serve(NewMyApi(), httptest.NewRequest("GET", "/user/profile?login=bad_user", nil))
+	if w.Code != 500 || !strings.Contains(logs.String(), `msg="method failed" method=Profile`) {
+		t.Errorf("%d %s, logged %q", w.Code, w.Body.String(), logs.String())
+	}
+	// ApiError is an answer, not a failure
+	logs.Reset()
+	serve(NewMyApi(), httptest.NewRequest("GET", "/user/profile?login=nobody", nil))
+	if logs.Len() != 0 {
+		t.Errorf("logged %q", logs.String())
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func preflight(h http.Handler, path, origin string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodOptions, path, nil)
+	r.Header.Set("Origin", origin)
+	r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestCORSServiceDefaults(t *testing.T) {
+	withConfig(t)
+	cases := []struct {
+		path   string
+		origin string
+		allow  string
+	}{
+		// Item inherits the policy of apigen:service even after Public set its own
+		{"/shop/items/1", "https://shop.example", "https://shop.example"},
+		{"/shop/items/1", "https://evil.example", ""},
+		{"/shop/public", "https://evil.example", "*"},
+	}
+	for _, c := range cases {
+		w := preflight(NewShopApi(), c.path, c.origin)
+		if w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != c.allow {
+			t.Errorf("%s from %s: %d %q, want 204 %q", c.path, c.origin, w.Code, w.Header().Get("Access-Control-Allow-Origin"), c.allow)
+		}
+	}
+}
+
+func TestCORSCredentialsAnyOrigin(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("WithCORS allowed credentials from any origin")
+		}
+	}()
+	WithCORS(&CORSPolicy{AllowOrigins: []string{"*"}, AllowCredentials: true})
+}
+
+func TestCORSCredentialsNoWildcard(t *testing.T) {
+	withConfig(t)
+	// set directly, WithCORS would panic
+	DefaultHandlerConfig.CORS = &CORSPolicy{AllowOrigins: []string{"*"}, AllowCredentials: true}
+	w := preflight(NewMyApi(), "/user/profile", "https://evil.example")
+	if got := w.Header().Get("Access-Control-Allow-Origin"); got != "" || w.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("evil origin allowed with credentials: %q", got)
+	}
+}
+
+func TestCORSPolicy(t *testing.T) {
+	withConfig(t, WithCORS(&CORSPolicy{
+		AllowOrigins:     []string{"https://app.example"},
+		AllowHeaders:     []string{"X-Auth"},
+		ExposeHeaders:    []string{"X-Request-ID"},
+		AllowCredentials: true,
+		MaxAge:           600,
+	}))
+	// preflights are answered before auth
+	r := httptest.NewRequest(http.MethodOptions, "/user/create", nil)
+	r.Header.Set("Origin", "https://app.example")
+	r.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	w := serve(NewMyApi(), r)
+	want := map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example",
+		"Access-Control-Allow-Methods":     "POST",
+		"Access-Control-Allow-Headers":     "X-Auth",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Max-Age":           "600",
+	}
+	if w.Code != http.StatusNoContent {
+		t.Errorf("preflight: %d %s", w.Code, w.Body.String())
+	}
+	for key, value := range want {
+		if got := w.Header().Get(key); got != value {
+			t.Errorf("preflight %s: %q, want %q", key, got, value)
+		}
+	}
+
+	// errors of actual requests carry the headers too, browsers read them only so
+	r = httptest.NewRequest(http.MethodPost, "/user/create", nil)
+	r.Header.Set("Origin", "https://app.example")
+	w = serve(NewMyApi(), r)
+	if w.Code != http.StatusForbidden || w.Header().Get("Access-Control-Allow-Origin") != "https://app.example" ||
+		w.Header().Get("Access-Control-Expose-Headers") != "X-Request-ID" {
+		t.Errorf("request: %d %v", w.Code, w.Header())
+	}
+
+	r = httptest.NewRequest(http.MethodGet, "/user/profile?login=rvasily", nil)
+	r.Header.Set("Origin", "https://evil.example")
+	if w := serve(NewMyApi(), r); w.Code != 200 || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("other origin: %d %v", w.Code, w.Header())
+	}
+}
+
+func TestCORSOff(t *testing.T) {
+	withConfig(t)
+	w := preflight(NewMyApi(), "/user/profile", "https://app.example")
+	if w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("%d %v", w.Code, w.Header())
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var (
+	png  = append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 100)...)
+	jpeg = append([]byte("\xff\xd8\xff\xe0"), make([]byte, 100)...)
+	gif  = append([]byte("GIF89a"), make([]byte, 100)...)
+)
+
+// formFile is a file part of a multipart form
+type formFile struct {
+	field   string
+	name    string
+	content []byte
+}
+
+func upload(files ...formFile) *httptest.ResponseRecorder {
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	for _, file := range files {
+		part, _ := form.CreateFormFile(file.field, file.name)
+		part.Write(file.content)
+	}
+	form.Close()
+	r := httptest.NewRequest("POST", "/shop/items/7/photo", body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	return serve(NewShopApi(), r)
+}
+
+func TestFileUpload(t *testing.T) {
+	withConfig(t)
+	big := append(append([]byte{}, png...), make([]byte, 1<<20)...)
+	cases := []struct {
+		name   string
+		files  []formFile
+		status int
+		want   string
+	}{
+		{"png", []formFile{{"photo", "a.png", png}}, 200, `{"error":"","response":{"id":"7","size":108,"thumbs":0}}`},
+		{"jpeg", []formFile{{"photo", "a.jpg", jpeg}}, 200, `"size":104`},
+		// the type is sniffed, not taken from the name
+		{"text", []formFile{{"photo", "a.png", []byte("plain text")}}, 400, "photo must be one of [image/png, image/jpeg]"},
+		{"gif", []formFile{{"photo", "a.gif", gif}}, 400, "photo must be one of [image/png, image/jpeg]"},
+		{"no file", nil, 400, "photo must me not empty"},
+		{"too large", []formFile{{"photo", "a.png", big}}, 400, "photo must be at most 1MB"},
+		{"thumbs", []formFile{{"photo", "a.png", png}, {"thumbs", "b.gif", gif}, {"thumbs", "c.jpg", jpeg}}, 200, `"thumbs":2`},
+		{"too many thumbs", []formFile{{"photo", "a.png", png}, {"thumbs", "b.png", png}, {"thumbs", "c.png", png}, {"thumbs", "d.png", png}},
+			400, "thumbs must have at most 2 files"},
+		{"not an image thumb", []formFile{{"photo", "a.png", png}, {"thumbs", "b.txt", []byte("plain text")}}, 400, "thumbs must be one of [image/*]"},
+	}
+	for _, c := range cases {
+		if w := upload(c.files...); w.Code != c.status || !strings.Contains(w.Body.String(), c.want) {
+			t.Errorf("%s: %d %s", c.name, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestFileUploadForm(t *testing.T) {
+	withConfig(t)
+	// files come only with multipart forms
+	r := httptest.NewRequest("POST", "/shop/items/7/photo", strings.NewReader("photo=a.png"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if w := serve(NewShopApi(), r); w.Code != 400 || !strings.Contains(w.Body.String(), "photo must me not empty") {
+		t.Errorf("%d %s", w.Code, w.Body.String())
+	}
+}
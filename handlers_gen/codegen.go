@@ -1,33 +1,49 @@
 package main
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"go/ast"
+	"go/format"
 	"go/parser"
+	"go/printer"
 	"go/token"
+	"io"
 	"log"
+	"math"
 	"net/http"
 	"os"
+	"reflect"
 	"sort"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
 )
 
 type tpl struct {
 	Value      string
+	Service    string
 	TypeName   string
 	MethodName string
 	ParamName  string
 	FieldName  string
 	IsInt      bool
 	Slice      []string
+	Timeout    string // Go expression of time.Duration
 }
 
 var (
 	funcMap = template.FuncMap{
-		"toLower":   strings.ToLower,
-		"joinComma": func(slice []string) string { return strings.Join(slice, ", ") },
+		"toLower":    strings.ToLower,
+		"joinComma":  func(slice []string) string { return strings.Join(slice, ", ") },
+		"lowerFirst": lowerFirst,
+		"svcExpr":    svcExpr,
+		"joinQuoted": func(slice []string) string { return strings.Join(slice, `", "`) },
+		"even":       func(i int) bool { return i%2 == 0 },
 	}
 
 	serveTplOpen = template.Must(template.New("serveTplOpen").Parse(`
@@ -36,53 +52,1690 @@ func (node *{{ .TypeName }}) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 `))
 	serveTplClose = template.Must(template.New("serveTplClose").Parse(`}
 `))
+	// TypeName | MethodName | Value - route | Service - API type
 	methodWrapOpen = template.Must(template.New("methodWrapOpen").Parse(`// [Wrapper for {{ .TypeName }}] method: {{ .MethodName }}
-func (node *{{ .TypeName }}) wrapper{{ .MethodName }}(w http.ResponseWriter, r *http.Request) {
+func (node *{{ .TypeName }}) wrapper{{ .MethodName }}(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
+	sw := &apigenStatusWriter{ResponseWriter: w}
+	w = sw
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	defer cfg.logAccess(sw, r, "{{ .Value }}", "{{ .MethodName }}", time.Now())
+	defer cfg.Metrics.start("{{ .Value }}", "{{ .MethodName }}").done(sw, time.Now())
+	if cfg.Tracer != nil {
+		var span Span
+		r, span = cfg.startSpan(r, "{{ .Service }}.{{ .MethodName }}", "{{ .Value }}")
+		defer apigenEndSpan(span, sw)
+	}
+	if !cfg.DisableRecovery {
+		defer cfg.recoverPanic(w, r, "{{ .MethodName }}")
+	}
+
+`))
+	// Value - limit of the annotation, cfg.MaxBodySize if empty
+	tplBodyLimit = template.Must(template.New("tplBodyLimit").Parse(
+		`	// Body limit, bodies known to be too large are rejected before reading
+	if bodyLimit := {{ if .Value }}int64({{ .Value }}){{ else }}cfg.MaxBodySize{{ end }}; bodyLimit > 0 {
+		if r.ContentLength > bodyLimit {
+			cfg.writeError(w, r, http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, bodyLimit)
+	}
+
+`))
+	// TypeName | MethodName | Value - API type | Slice - middleware names
+	tplMiddleware = template.Must(template.New("tplMiddleware").Funcs(funcMap).Parse(
+		`	// Middlewares run after the checks, before binding params
+	cfg.chain(apigenChain{{ .TypeName }}{{ .MethodName }}).handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apigenNodeKey{}, node)))
+}
+
+// [Handler for {{ .TypeName }}] method: {{ .MethodName }}, binds params and calls the method
+func (node *{{ .TypeName }}) handle{{ .MethodName }}(cfg *HandlerConfig, w http.ResponseWriter, r *http.Request) {
 `))
 	methodWrapClose = template.Must(template.New("methodWrapClose").Parse(`}
 `))
-	tplServeHTTP = template.Must(template.New("tplServeHTTP").Parse(
-		`		node.wrapper{{ .MethodName }}(w, r)
+	// Value - field with the API type when called from Router
+	tplServeHTTP = template.Must(template.New("tplServeHTTP").Funcs(funcMap).Parse(
+		`		node.{{ .Value }}wrapper{{ .MethodName }}(cfg, w, {{ if .Slice }}apigenWithPathParams(r, []string{"{{ .Slice | joinQuoted }}"}, &pathValues){{ else }}r{{ end }})
+`))
+	// API type names
+	// Types - API type names | Handler - API types have handler types
+	tplNewRouter = template.Must(template.New("tplNewRouter").Funcs(funcMap).Parse(`
+// NewRouter makes one http.Handler for all API types, unknown middleware names panic
+func NewRouter({{ range $i, $name := .Types }}{{ if $i }}, {{ end }}{{ $name | lowerFirst }} {{ if $.Handler }}{{ $name }}Service{{ else }}*{{ $name }}{{ end }}{{ end }}, opts ...HandlerOption) *Router {
+	router := &Router{
+{{ range .Types }}		{{ . | lowerFirst }}: {{ if $.Handler }}New{{ . }}Handler({{ . | lowerFirst }}, opts...){{ else }}{{ . | lowerFirst }}{{ end }},
+{{ end }}		cfg: NewHandlerConfig(opts...),
+	}
+{{ range .Types }}	router.cfg.mustBuildChains(apigenChains{{ . }}{{ if $.Handler }}Handler{{ end }})
+{{ end }}	return router
+}
+`))
+	// TypeName | Methods - method signatures | Signature - has signature methods
+	tplServiceInterface = template.Must(template.New("tplServiceInterface").Parse(`
+// {{ .TypeName }}Service is what generated handlers need from {{ .TypeName }}
+type {{ .TypeName }}Service interface {
+{{ if .Signature }}	SignatureSecretProvider
+{{ end }}{{ range .Methods }}	{{ . }}
+{{ end }}}
+
+var _ {{ .TypeName }}Service = (*{{ .TypeName }})(nil)
+`))
+	// TypeName
+	tplHandlerType = template.Must(template.New("tplHandlerType").Parse(`
+// {{ .TypeName }}Handler serves HTTP for any {{ .TypeName }}Service
+type {{ .TypeName }}Handler struct {
+	svc {{ .TypeName }}Service
+	cfg HandlerConfig
+}
+
+// New{{ .TypeName }}Handler wraps svc with generated HTTP handlers
+// and builds middleware chains, unknown middleware names panic
+func New{{ .TypeName }}Handler(svc {{ .TypeName }}Service, opts ...HandlerOption) *{{ .TypeName }}Handler {
+	node := &{{ .TypeName }}Handler{svc: svc, cfg: NewHandlerConfig(opts...)}
+	node.cfg.mustBuildChains(apigenChains{{ .TypeName }}Handler)
+	return node
+}
+`))
+	// TypeName | Handler - API type has handler type | Patterns - Value pattern, MethodName |
+	// Preflights - Value pattern, Slice verb and method pairs
+	tplRegister = template.Must(template.New("tplRegister").Funcs(funcMap).Parse(`
+// Register{{ .TypeName }} adds methods of {{ .TypeName }} to mux, unknown middleware names panic,
+// patterns like "POST /user/{id}" need Go 1.22 and go 1.22+ in go.mod
+func Register{{ .TypeName }}(mux *http.ServeMux, svc {{ if .Handler }}{{ .TypeName }}Service{{ else }}*{{ .TypeName }}{{ end }}, opts ...HandlerOption) {
+{{ if .Handler }}	node := New{{ .TypeName }}Handler(svc, opts...)
+	cfg := &node.cfg
+{{ else }}	node := svc
+	cfg := NewHandlerConfig(opts...)
+	cfg.mustBuildChains(apigenChains{{ .TypeName }})
+{{ end }}{{ range .Patterns }}	mux.HandleFunc("{{ .Value }}", func(w http.ResponseWriter, r *http.Request) {
+		node.wrapper{{ .MethodName }}({{ if not $.Handler }}&{{ end }}cfg, w, r)
+	})
+{{ end }}{{ range .Preflights }}	mux.HandleFunc("{{ .Value }}", func(w http.ResponseWriter, r *http.Request) {
+		if cfg.RequestIDHeader != "" {
+			r = cfg.withRequestID(w, r)
+		}
+		switch apigenPreflightMethod(r) {
+{{ range $i, $v := .Slice }}{{ if even $i }}		case "{{ $v }}":
+{{ else }}			node.wrapper{{ $v }}({{ if not $.Handler }}&{{ end }}cfg, w, r)
+{{ end }}{{ end }}		default:
+			cfg.writeError(w, r, http.StatusNotAcceptable, errors.New("bad method"))
+		}
+	})
+{{ end }}}
+`))
+	// TypeName | Cfg - config of the handler | Methods - genMethod with Field holding the API type
+	tplRoutes = template.Must(template.New("tplRoutes").Parse(`
+// Routes of {{ .TypeName }} for any router
+func (node *{{ .TypeName }}) Routes() []Route {
+	cfg := {{ .Cfg }}
+	return []Route{
+{{ range .Methods }}		{
+			Method:      "{{ .Options.Method }}",
+			Pattern:     "{{ .Options.URL }}",
+			Handler:     func(w http.ResponseWriter, r *http.Request) { node.{{ .Field }}wrapper{{ .Name }}(cfg, w, r) },
+			Service:     "{{ .Recv }}",
+			Name:        "{{ .Name }}",
+			Auth:        {{ .Options.Auth }},
+			AuthScheme:  "{{ .Options.AuthScheme }}",
+			ParamStruct: "{{ .ValidName }}",
+			Params: []RouteParam{
+{{ range .Params }}				{Name: "{{ .Name }}", In: "{{ .In }}"},
+{{ end }}			},
+		},
+{{ end }}	}
+}
+`))
+	// Value - config of the handler
+	tplRouting = template.Must(template.New("tplRouting").Parse(
+		`	cfg := {{ .Value }}
+	// before routing, so redirects, 404 and 406 carry the ID too
+	if cfg.RequestIDHeader != "" {
+		r = cfg.withRequestID(w, r)
+	}
+	var pathValues [apigenMaxPathParams]string
+	route, handled := apigenRouteRequest(apigenRoutes{{ .TypeName }}, w, r, &pathValues)
+	if handled {
+		return
+	}
+	switch route {
+`))
+	tplRouterSupport = template.Must(template.New("tplRouterSupport").Parse(`
+// apigenMaxPathParams is how many {name} segments a route can have
+const apigenMaxPathParams = {{ .Value }}
+
+// apigenRouteNode is a node of the precomputed segment tree of routes,
+// route numbers start from 1, 0 means there is no route
+type apigenRouteNode struct {
+	static   map[string]*apigenRouteNode // exact segments, take priority
+	param    *apigenRouteNode            // {name} segment
+	route    int                         // route ending at this node
+	catchAll int                         // {name...} route taking the rest of the path
+}
+
+// match finds the route for path without the leading slash,
+// values of {name} segments are put to values starting from n
+func (node *apigenRouteNode) match(path string, values *[apigenMaxPathParams]string, n int) int {
+	segment, rest, last := path, "", true
+	if i := strings.IndexByte(path, '/'); i >= 0 {
+		segment, rest, last = path[:i], path[i+1:], false
+	}
+	if child, ok := node.static[segment]; ok {
+		if last && child.route != 0 {
+			return child.route
+		}
+		if !last {
+			if route := child.match(rest, values, n); route != 0 {
+				return route
+			}
+		}
+	}
+	if node.param != nil && segment != "" {
+		values[n] = segment
+		if last && node.param.route != 0 {
+			return node.param.route
+		}
+		if !last {
+			if route := node.param.match(rest, values, n+1); route != 0 {
+				return route
+			}
+		}
+	}
+	if node.catchAll != 0 {
+		values[n] = path
+		return node.catchAll
+	}
+	return 0
+}
+
+// apigenRouteRequest matches the request path against the tree. Paths that are not clean
+// are redirected to the cleaned ones, unknown paths are redirected to the same path
+// with or without the trailing slash if that one exists. handled means that
+// the redirect is already written
+func apigenRouteRequest(tree *apigenRouteNode, w http.ResponseWriter, r *http.Request, values *[apigenMaxPathParams]string) (route int, handled bool) {
+	reqPath := r.URL.Path
+	if reqPath == "" || reqPath[0] != '/' {
+		return 0, false
+	}
+	cleaned := path.Clean(reqPath)
+	if reqPath[len(reqPath)-1] == '/' && cleaned != "/" {
+		if reqPath[:len(reqPath)-1] != cleaned {
+			apigenRedirectPath(w, r, cleaned+"/")
+			return 0, true
+		}
+	} else if reqPath != cleaned {
+		apigenRedirectPath(w, r, cleaned)
+		return 0, true
+	}
+	if route = tree.match(reqPath[1:], values, 0); route != 0 || reqPath == "/" {
+		return route, false
+	}
+	other := reqPath + "/"
+	if reqPath[len(reqPath)-1] == '/' {
+		other = reqPath[:len(reqPath)-1]
+	}
+	var otherValues [apigenMaxPathParams]string
+	if tree.match(other[1:], &otherValues, 0) != 0 {
+		apigenRedirectPath(w, r, other)
+		return 0, true
+	}
+	return 0, false
+}
+
+func apigenRedirectPath(w http.ResponseWriter, r *http.Request, to string) {
+	code := http.StatusPermanentRedirect
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		code = http.StatusMovedPermanently
+	}
+	target := *r.URL
+	target.Path = to
+	target.RawPath = ""
+	http.Redirect(w, r, target.String(), code)
+}
+
+type apigenPathParamsKey struct{}
+
+type apigenPathParams struct {
+	names  []string
+	values [apigenMaxPathParams]string
+}
+
+func apigenWithPathParams(r *http.Request, names []string, values *[apigenMaxPathParams]string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), apigenPathParamsKey{}, &apigenPathParams{names, *values}))
+}
+
+// WithPathParams gives values of {name} segments to handlers of Routes()
+// when the path is matched by another router
+func WithPathParams(r *http.Request, params map[string]string) *http.Request {
+	names := make([]string, 0, len(params))
+	var values [apigenMaxPathParams]string
+	for name, value := range params {
+		if len(names) == apigenMaxPathParams {
+			break
+		}
+		values[len(names)] = value
+		names = append(names, name)
+	}
+	return apigenWithPathParams(r, names, &values)
+}
+
+// PathParam returns the value of {name} segment of the matched route
+func PathParam(r *http.Request, name string) string {
+	params, _ := r.Context().Value(apigenPathParamsKey{}).(*apigenPathParams)
+	if params == nil {
+		return ""
+	}
+	for i, have := range params.names {
+		if have == name {
+			return params.values[i]
+		}
+	}
+	return ""
+}
 `))
+	// Value - auth scheme
 	tplAuth = template.Must(template.New("tplAuth").Parse(
-		`	// Authorization checker	
-	authGood := "100500"
-	auth := r.Header.Get("X-Auth")
-	if auth != authGood {
-		w.WriteHeader(http.StatusForbidden)
-		data, _ := json.Marshal(resValue{"error": "unauthorized"})
-		io.WriteString(w, string(data))
+		`	// Authorization checker ({{ .Value }})
+	{{ if eq .Value "basic" }}authUser, authPassword, _ := r.BasicAuth()
+	authCred := AuthCredential{Scheme: "basic", User: authUser, Password: authPassword}
+	{{ else if eq .Value "query" }}authCred := AuthCredential{Scheme: "query", Token: r.URL.Query().Get("api_key")}
+	{{ else if eq .Value "cookie" }}authCred := AuthCredential{Scheme: "cookie"}
+	if authCookie, err := r.Cookie("api_key"); err == nil {
+		authCred.Token = authCookie.Value
+	}
+	{{ else }}authCred := AuthCredential{Scheme: "header", Token: r.Header.Get("X-Auth")}
+	{{ end }}if !cfg.AuthVerifier(r, authCred) {
+		cfg.writeError(w, r, http.StatusForbidden, errors.New("unauthorized"))
+		return
+	}
+
+`))
+	tplConfigSupport = template.Must(template.New("tplConfigSupport").Parse(`
+// AuthCredential is what the authorization checker read from the request:
+// Token for header (X-Auth), query (?api_key=) and cookie (api_key) schemes,
+// User and Password for basic
+type AuthCredential struct {
+	Scheme   string
+	Token    string
+	User     string
+	Password string
+}
+
+// AuthVerifier decides whether the credential is good enough,
+// it's used by every wrapper with "auth": true, whatever the scheme
+type AuthVerifier func(r *http.Request, cred AuthCredential) bool
+
+// DefaultAuthVerifier accepts the 100500 token (or password for basic)
+func DefaultAuthVerifier(r *http.Request, cred AuthCredential) bool {
+	if cred.Scheme == "basic" {
+		return cred.Password == "100500"
+	}
+	return cred.Token == "100500"
+}
+
+// ErrorEncoder writes every error response of generated handlers
+type ErrorEncoder func(w http.ResponseWriter, r *http.Request, status int, err error)
+
+// DefaultErrorEncoder writes {"error": "<err>", "request_id": "<id>"} with status
+func DefaultErrorEncoder(w http.ResponseWriter, r *http.Request, status int, err error) {
+	res := apigenResValue{"error": err.Error()}
+	if id := RequestIDFromContext(r.Context()); id != "" {
+		res["request_id"] = id
+	}
+	data, _ := json.Marshal(res)
+	w.WriteHeader(status)
+	io.WriteString(w, string(data))
+}
+
+// HandlerConfig is what generated handlers do at runtime, make it with NewHandlerConfig
+type HandlerConfig struct {
+	AuthVerifier AuthVerifier // checks credentials of "auth": true methods
+	ErrorEncoder ErrorEncoder // writes validation, auth and method errors
+	Logger       *slog.Logger // gets method errors that are not ApiError
+	MaxBodySize  int64        // body limit of methods without "max_body", 0 means no limit
+	// bytes of multipart forms kept in memory, files over it go to temp files
+	MultipartMemory int64
+	NotFound     http.Handler // serves unknown paths, "unknown method" error if nil
+
+	// request ID is read from this header or generated, echoed in it and put into ctx,
+	// "" turns request IDs off
+	RequestIDHeader string
+
+	// one record per request of every wrapper, nil turns access logs off
+	AccessLogger *slog.Logger
+	// request counts, latencies and in-flight requests, DefaultMetrics unless changed, nil turns them off
+	Metrics *Metrics
+	// starts a span for every request continuing W3C traceparent, nil turns tracing off
+	Tracer Tracer
+	// token buckets of "rate_limit" methods, in-memory unless changed, nil turns rate limits off
+	RateLimitStore RateLimitStore
+	// CORS policy of methods without "cors" in apigen:api, nil allows no cross-origin requests
+	CORS *CORSPolicy
+	// header with a timeout of the client like "1.5s", capped by "timeout" of the method, "" ignores it
+	DeadlineHeader string
+
+	// panics of wrappers, middlewares and methods are logged with the stack
+	// and answered with 500 unless DisableRecovery is set
+	DisableRecovery bool
+
+	// middlewares run in this order after auth, method and signature checks
+	Middlewares        []Middleware            // for every method
+	ServiceMiddlewares map[string][]Middleware // for methods of the API type
+	NamedMiddlewares   map[string]Middleware   // registry for "middleware" of apigen:api
+
+	chains *apigenChainCache // middleware chains of methods, made by NewHandlerConfig
+}
+
+// apigenStatusWriter remembers the response for access logs
+type apigenStatusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+	err    error // the error given to ErrorEncoder
+}
+
+func (sw *apigenStatusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *apigenStatusWriter) Write(data []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	n, err := sw.ResponseWriter.Write(data)
+	sw.bytes += int64(n)
+	return n, err
+}
+
+func (sw *apigenStatusWriter) Unwrap() http.ResponseWriter {
+	return sw.ResponseWriter
+}
+
+// writeError gives err to ErrorEncoder and remembers it for logs,
+// w may be wrapped by middlewares that have Unwrap
+func (cfg *HandlerConfig) writeError(w http.ResponseWriter, r *http.Request, status int, err error) {
+	for next := w; next != nil; {
+		if sw, ok := next.(*apigenStatusWriter); ok {
+			sw.err = err
+			break
+		}
+		unwrapper, ok := next.(interface{ Unwrap() http.ResponseWriter })
+		if !ok {
+			break
+		}
+		next = unwrapper.Unwrap()
+	}
+	cfg.ErrorEncoder(w, r, status, err)
+}
+
+type apigenRequestIDKey struct{}
+
+// RequestIDFromContext returns the ID of the request, "" if there is none
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(apigenRequestIDKey{}).(string)
+	return id
+}
+
+// withRequestID reuses a sane ID of the client or makes a new one,
+// requests that got an ID from ServeHTTP keep it
+func (cfg *HandlerConfig) withRequestID(w http.ResponseWriter, r *http.Request) *http.Request {
+	if RequestIDFromContext(r.Context()) != "" {
+		return r
+	}
+	id := r.Header.Get(cfg.RequestIDHeader)
+	if !apigenValidRequestID(id) {
+		var raw [16]byte
+		rand.Read(raw[:])
+		id = hex.EncodeToString(raw[:])
+	}
+	w.Header().Set(cfg.RequestIDHeader, id)
+	return r.WithContext(context.WithValue(r.Context(), apigenRequestIDKey{}, id))
+}
+
+func apigenValidRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// DefaultMultipartMemory is what ParseMultipartForm keeps in memory by default, the rest goes to temp files
+const DefaultMultipartMemory = 32 << 20
+
+// apigenRequestValues are params of the request by where they come from
+type apigenRequestValues struct {
+	query url.Values
+	body  url.Values
+}
+
+// Get returns the value from the body or, if it has none, from the query like r.Form
+func (values apigenRequestValues) Get(key string) string {
+	if body := values.body[key]; len(body) > 0 {
+		return body[0]
+	}
+	return values.query.Get(key)
+}
+
+// bindValues reads params of the request: the query and, for POST, PUT and PATCH,
+// the body chosen by Content-Type - a form or a JSON object with paramname keys.
+// Scalars of JSON are bound as their text, so the same validation runs for every format,
+// keys that are not in params may hold anything and are skipped.
+// It answers errors itself, ok is false then
+func (cfg *HandlerConfig) bindValues(w http.ResponseWriter, r *http.Request, params []string) (values apigenRequestValues, ok bool) {
+	query, err := url.ParseQuery(r.URL.RawQuery)
+	if err != nil {
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("bad query"))
+		return values, false
+	}
+	values.query = query
+	mediaType := ""
+	if r.Method == http.MethodPost || r.Method == http.MethodPut || r.Method == http.MethodPatch {
+		if contentType := r.Header.Get("Content-Type"); contentType != "" {
+			if mediaType, _, err = mime.ParseMediaType(contentType); err != nil {
+				cfg.writeError(w, r, http.StatusUnsupportedMediaType, errors.New("unsupported content type"))
+				return values, false
+			}
+		}
+	}
+	switch {
+	case mediaType == "" || mediaType == "application/x-www-form-urlencoded":
+		if err := r.ParseForm(); err != nil {
+			cfg.writeBodyError(w, r, err, "bad form")
+			return values, false
+		}
+		values.body = r.PostForm
+		return values, true
+	case mediaType == "multipart/form-data":
+		if err := r.ParseMultipartForm(cfg.MultipartMemory); err != nil {
+			cfg.writeBodyError(w, r, err, "bad form")
+			return values, false
+		}
+		values.body = r.PostForm
+		return values, true
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		body := map[string]any{}
+		decoder := json.NewDecoder(r.Body)
+		decoder.UseNumber()
+		if err := decoder.Decode(&body); err != nil {
+			cfg.writeBodyError(w, r, err, "bad json")
+			return values, false
+		}
+		values.body = url.Values{}
+		for _, key := range params {
+			value, ok := body[key]
+			if !ok {
+				continue
+			}
+			str := ""
+			switch value := value.(type) {
+			case nil:
+			case string:
+				str = value
+			case json.Number:
+				str = value.String()
+			case bool:
+				str = strconv.FormatBool(value)
+			default:
+				cfg.writeError(w, r, http.StatusBadRequest, errors.New(key+" must be a scalar"))
+				return values, false
+			}
+			values.body.Set(key, str)
+		}
+		return values, true
+	}
+	cfg.writeError(w, r, http.StatusUnsupportedMediaType, errors.New("unsupported content type"))
+	return values, false
+}
+
+// apigenCookieValue is the value of the cookie, "" if there is none
+func apigenCookieValue(r *http.Request, name string) string {
+	cookie, err := r.Cookie(name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// writeBodyError answers 413 if the body is over the limit and 400 with msg otherwise
+func (cfg *HandlerConfig) writeBodyError(w http.ResponseWriter, r *http.Request, err error, msg string) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		cfg.writeError(w, r, http.StatusRequestEntityTooLarge, errors.New("request body too large"))
+		return
+	}
+	cfg.writeError(w, r, http.StatusBadRequest, errors.New(msg))
+}
+
+// methodContext bounds ctx of the method by timeout of the annotation (0 if none)
+// and by the deadline header of the client, whichever is shorter
+func (cfg *HandlerConfig) methodContext(r *http.Request, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if cfg.DeadlineHeader != "" {
+		client, err := time.ParseDuration(r.Header.Get(cfg.DeadlineHeader))
+		if err == nil && client > 0 && (timeout == 0 || client < timeout) {
+			timeout = client
+		}
+	}
+	if timeout == 0 {
+		return r.Context(), func() {}
+	}
+	return context.WithTimeout(r.Context(), timeout)
+}
+
+// logAccess is deferred by every wrapper
+func (cfg *HandlerConfig) logAccess(sw *apigenStatusWriter, r *http.Request, route, method string, start time.Time) {
+	if cfg.AccessLogger == nil {
+		return
+	}
+	status := sw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	attrs := []slog.Attr{
+		slog.String("route", route),
+		slog.String("method", method),
+		slog.String("http_method", r.Method),
+		slog.Int("status", status),
+		slog.Duration("latency", time.Since(start)),
+		slog.Int64("bytes", sw.bytes),
+		slog.String("remote_addr", r.RemoteAddr),
+	}
+	if id := RequestIDFromContext(r.Context()); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	level := slog.LevelInfo
+	if sw.err != nil {
+		attrs = append(attrs, slog.String("error", sw.err.Error()))
+	}
+	if status >= http.StatusInternalServerError {
+		level = slog.LevelError
+	}
+	cfg.AccessLogger.LogAttrs(r.Context(), level, "request", attrs...)
+}
+
+// recoverPanic is deferred by every wrapper
+func (cfg *HandlerConfig) recoverPanic(w http.ResponseWriter, r *http.Request, method string) {
+	rec := recover()
+	if rec == nil {
+		return
+	}
+	if rec == http.ErrAbortHandler {
+		panic(rec)
+	}
+	cfg.Logger.Error("panic in handler", "method", method, "request_id", RequestIDFromContext(r.Context()), "panic", rec, "stack", string(debug.Stack()))
+	cfg.writeError(w, r, http.StatusInternalServerError, errors.New("internal error"))
+}
+
+// Middleware wraps binding params, calling the method and writing the response
+type Middleware func(next http.Handler) http.Handler
+
+// apigenChainSpec is the middleware chain of one method, handler makes its innermost
+// handler calling the method of the API value the wrapper put into ctx
+type apigenChainSpec struct {
+	service        string
+	names          []string
+	handler        func(cfg *HandlerConfig) http.Handler
+	maxConcurrency int // "max_concurrency" of the method, 0 means no limit
+}
+
+// apigenChainState is what a config built for one method
+type apigenChainState struct {
+	handler http.Handler  // the middleware chain
+	slots   chan struct{} // calls in flight, nil without "max_concurrency"
+}
+
+// apigenNodeKey holds the API value of the request, so one chain serves all of them
+type apigenNodeKey struct{}
+
+// apigenChainCache keeps chains built by constructors or on first use
+type apigenChainCache struct {
+	mu     sync.RWMutex
+	states map[*apigenChainSpec]*apigenChainState
+}
+
+// buildChain wraps the method with global, service and method middlewares
+func (cfg *HandlerConfig) buildChain(spec *apigenChainSpec) (http.Handler, error) {
+	h := spec.handler(cfg)
+	for i := len(spec.names) - 1; i >= 0; i-- {
+		mw, ok := cfg.NamedMiddlewares[spec.names[i]]
+		if !ok {
+			return nil, errors.New("unknown middleware " + spec.names[i] + " of " + spec.service)
+		}
+		h = mw(h)
+	}
+	for i := len(cfg.ServiceMiddlewares[spec.service]) - 1; i >= 0; i-- {
+		h = cfg.ServiceMiddlewares[spec.service][i](h)
+	}
+	for i := len(cfg.Middlewares) - 1; i >= 0; i-- {
+		h = cfg.Middlewares[i](h)
+	}
+	return h, nil
+}
+
+// mustBuildChains builds chains once for constructors, unknown middlewares panic
+func (cfg *HandlerConfig) mustBuildChains(specs []*apigenChainSpec) {
+	for _, spec := range specs {
+		h, err := cfg.buildChain(spec)
+		if err != nil {
+			panic("apigen: " + err.Error())
+		}
+		cfg.storeChain(spec, h)
+	}
+}
+
+// storeChain keeps the chain of the first call, so all requests share the slots
+func (cfg *HandlerConfig) storeChain(spec *apigenChainSpec, h http.Handler) *apigenChainState {
+	state := &apigenChainState{handler: h}
+	if spec.maxConcurrency > 0 {
+		state.slots = make(chan struct{}, spec.maxConcurrency)
+	}
+	if cfg.chains == nil {
+		return state
+	}
+	cfg.chains.mu.Lock()
+	defer cfg.chains.mu.Unlock()
+	if cfg.chains.states == nil {
+		cfg.chains.states = map[*apigenChainSpec]*apigenChainState{}
+	}
+	if stored := cfg.chains.states[spec]; stored != nil {
+		return stored
+	}
+	cfg.chains.states[spec] = state
+	return state
+}
+
+// chain returns the chain of the method and its slots, configs not passed to a constructor
+// build them on first use and answer 500 for unknown middlewares.
+// HandlerConfig literals have no cache, chains and slots are made per request then
+func (cfg *HandlerConfig) chain(spec *apigenChainSpec) *apigenChainState {
+	if cfg.chains != nil {
+		cfg.chains.mu.RLock()
+		state := cfg.chains.states[spec]
+		cfg.chains.mu.RUnlock()
+		if state != nil {
+			return state
+		}
+	}
+	h, err := cfg.buildChain(spec)
+	if err != nil {
+		cfg.Logger.Error("bad handler config", "service", spec.service, "error", err)
+		h = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			cfg.writeError(w, r, http.StatusInternalServerError, err)
+		})
+	}
+	return cfg.storeChain(spec, h)
+}
+
+// HandlerOption changes HandlerConfig
+type HandlerOption func(cfg *HandlerConfig)
+
+func WithAuthVerifier(verifier AuthVerifier) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.AuthVerifier = verifier }
+}
+
+func WithErrorEncoder(encoder ErrorEncoder) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.ErrorEncoder = encoder }
+}
+
+func WithLogger(logger *slog.Logger) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.Logger = logger }
+}
+
+// DefaultMaxBodySize is the body limit of NewHandlerConfig, the form limit of net/http
+const DefaultMaxBodySize = 10 << 20
+
+// WithMaxBodySize changes the body limit of methods without "max_body", 0 turns it off
+func WithMaxBodySize(size int64) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.MaxBodySize = size }
+}
+
+// WithMultipartMemory changes bytes of multipart forms kept in memory
+func WithMultipartMemory(size int64) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.MultipartMemory = size }
+}
+
+func WithNotFound(handler http.Handler) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.NotFound = handler }
+}
+
+// WithRequestIDHeader changes X-Request-ID, "" turns request IDs off
+func WithRequestIDHeader(header string) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.RequestIDHeader = header }
+}
+
+// WithRateLimitStore changes where token buckets of rate limits are kept, nil turns rate limits off
+func WithRateLimitStore(store RateLimitStore) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.RateLimitStore = store }
+}
+
+// WithDeadlineHeader lets clients shorten ctx of methods by a timeout in header
+func WithDeadlineHeader(header string) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.DeadlineHeader = header }
+}
+
+// WithCORS sets CORS policy of methods without "cors" in apigen:api
+// It panics if policy allows credentials from any origin ("*"), that lets any site act as the user
+func WithCORS(policy *CORSPolicy) HandlerOption {
+	if policy != nil && policy.AllowCredentials && apigenContains(policy.AllowOrigins, "*") {
+		panic("apigen: CORS policy with AllowCredentials can't allow any origin")
+	}
+	return func(cfg *HandlerConfig) { cfg.CORS = policy }
+}
+
+func WithTracer(tracer Tracer) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.Tracer = tracer }
+}
+
+func WithMetrics(metrics *Metrics) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.Metrics = metrics }
+}
+
+func WithAccessLogger(logger *slog.Logger) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.AccessLogger = logger }
+}
+
+// WithoutRecovery lets panics go to net/http
+func WithoutRecovery() HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.DisableRecovery = true }
+}
+
+func WithMiddleware(mws ...Middleware) HandlerOption {
+	return func(cfg *HandlerConfig) { cfg.Middlewares = append(cfg.Middlewares, mws...) }
+}
+
+// WithServiceMiddleware adds middlewares for methods of the API type named service
+func WithServiceMiddleware(service string, mws ...Middleware) HandlerOption {
+	return func(cfg *HandlerConfig) {
+		if cfg.ServiceMiddlewares == nil {
+			cfg.ServiceMiddlewares = map[string][]Middleware{}
+		}
+		cfg.ServiceMiddlewares[service] = append(cfg.ServiceMiddlewares[service], mws...)
+	}
+}
+
+// WithNamedMiddleware registers mw for "middleware": ["name"] of apigen:api
+func WithNamedMiddleware(name string, mw Middleware) HandlerOption {
+	return func(cfg *HandlerConfig) {
+		if cfg.NamedMiddlewares == nil {
+			cfg.NamedMiddlewares = map[string]Middleware{}
+		}
+		cfg.NamedMiddlewares[name] = mw
+	}
+}
+
+// NewHandlerConfig makes the default config changed by opts
+func NewHandlerConfig(opts ...HandlerOption) HandlerConfig {
+	cfg := HandlerConfig{
+		AuthVerifier: DefaultAuthVerifier,
+		ErrorEncoder:    DefaultErrorEncoder,
+		Logger:          slog.Default(),
+		Metrics:         DefaultMetrics,
+		MaxBodySize:     DefaultMaxBodySize,
+		MultipartMemory: DefaultMultipartMemory,
+		RequestIDHeader: "X-Request-ID",
+		RateLimitStore:  NewMemoryRateLimitStore(),
+		chains:          &apigenChainCache{},
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	return cfg
+}
+
+// DefaultHandlerConfig is used by ServeHTTP of API types, change it before serving
+var DefaultHandlerConfig = NewHandlerConfig()
+
+// Route is one generated method for any router, made by Routes()
+type Route struct {
+	Method      string           // HTTP method, empty means any
+	Pattern     string           // url with {name} segments, service prefix included
+	Handler     http.HandlerFunc // the wrapper with all the checks
+	Service     string           // API type
+	Name        string           // Go method
+	Auth        bool
+	AuthScheme  string
+	ParamStruct string       // type of the method params
+	Params      []RouteParam // fields of ParamStruct
+}
+
+// RouteParam tells where a field of the params struct is read from
+type RouteParam struct {
+	Name string // paramname
+	In   string // query, body, header, cookie, path or "" for the body or the query
+}
+`))
+	// genMethod
+	tplRateLimit = template.Must(template.New("tplRateLimit").Parse(
+		`	// Rate limit ({{ .Options.RateLimit.RPS }} rps, burst {{ .Options.RateLimit.Burst }} by {{ .Options.RateLimit.Key }})
+	if cfg.RateLimitStore != nil {
+		{{ if eq .Options.RateLimit.Key "ip" }}rateKey := apigenClientIP(r)
+		{{ else if eq .Options.RateLimit.Key "principal" }}rateKey := apigenSecretKey(authCred.{{ if eq .Options.AuthScheme "basic" }}User{{ else }}Token{{ end }})
+		{{ else }}rateKey := apigenClientIP(r)
+		if apiKey := r.Header.Get("{{ slice .Options.RateLimit.Key 7 }}"); apiKey != "" {
+			rateKey = apigenSecretKey(apiKey)
+		}
+		{{ end }}if ok, retryAfter := cfg.RateLimitStore.Allow("{{ .Recv }}.{{ .Name }}:"+rateKey, {{ .Options.RateLimit.RPS }}, {{ .Options.RateLimit.Burst }}, time.Now()); !ok {
+			cfg.rateLimited(w, r, retryAfter)
+			return
+		}
+	}
+
+`))
+	// Value - name of the values, "" when only files are read | Slice - paramnames bound from JSON
+	tplParseForm = template.Must(template.New("tplParseForm").Funcs(funcMap).Parse(
+		`	{{ if .Value }}{{ .Value }}{{ else }}_{{ end }}, ok := cfg.bindValues(w, r, {{ if .Slice }}[]string{"{{ .Slice | joinQuoted }}"}{{ else }}nil{{ end }})
+	if !ok {
+		return
+	}
+	if r.MultipartForm != nil {
+		// net/http removes temp files of the request it made, not of r made by WithContext
+		defer r.MultipartForm.RemoveAll()
+	}
+`))
+	// genMethod
+	tplCORSVar = template.Must(template.New("tplCORSVar").Funcs(funcMap).Parse(`
+// CORS policy of {{ .Recv }}.{{ .Name }}
+var apigenCors{{ .Recv }}{{ .Name }} = &CORSPolicy{
+	AllowOrigins: []string{"{{ .Options.CORS.Origins | joinQuoted }}"},
+{{ with .Options.CORS.Methods }}	AllowMethods: []string{"{{ . | joinQuoted }}"},
+{{ end }}{{ with .Options.CORS.Headers }}	AllowHeaders: []string{"{{ . | joinQuoted }}"},
+{{ end }}{{ with .Options.CORS.ExposeHeaders }}	ExposeHeaders: []string{"{{ . | joinQuoted }}"},
+{{ end }}{{ if .Options.CORS.Credentials }}	AllowCredentials: true,
+{{ end }}{{ with .Options.CORS.MaxAge }}	MaxAge: {{ . }},
+{{ end }}}
+`))
+	// genMethod
+	tplCORS = template.Must(template.New("tplCORS").Parse(
+		`	// CORS, preflights are answered here
+	if cfg.handleCORS(w, r, {{ if .Options.CORS.Origins }}apigenCors{{ .Recv }}{{ .Name }}{{ else }}nil{{ end }}, "{{ .Options.Method }}") {
+		return
+	}
+
+`))
+	// genMethod
+	// TypeName - handler type | Service - API type | Middleware - names | MaxConcurrency
+	tplChainVar = template.Must(template.New("tplChainVar").Funcs(funcMap).Parse(`
+// middleware chain and concurrency limit of {{ .Service }}.{{ .MethodName }}
+var apigenChain{{ .TypeName }}{{ .MethodName }} = &apigenChainSpec{
+	service: "{{ .Service }}",
+	names:   {{ if .Middleware }}[]string{"{{ .Middleware | joinQuoted }}"}{{ else }}nil{{ end }},
+{{ if .MaxConcurrency }}	maxConcurrency: {{ .MaxConcurrency }},
+{{ end }}	handler: func(cfg *HandlerConfig) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			r.Context().Value(apigenNodeKey{}).(*{{ .TypeName }}).handle{{ .MethodName }}(cfg, w, r)
+		})
+	},
+}
+`))
+	// TypeName - handler type | Slice - method names
+	tplChains = template.Must(template.New("tplChains").Parse(`
+// middleware chains of {{ .TypeName }} built by constructors
+var apigenChains{{ .TypeName }} = []*apigenChainSpec{ {{- range .Slice }}apigenChain{{ $.TypeName }}{{ . }}, {{ end }}}
+`))
+	// genMethod | TypeName - handler type | Timeout - queue wait
+	tplConcurrency = template.Must(template.New("tplConcurrency").Parse(
+		`	// Concurrency limit ({{ .Method.Options.MaxConcurrency }} calls, queue wait {{ .Timeout }})
+	slots := apigenConcurrencyLimit(cfg.chain(apigenChain{{ .TypeName }}{{ .Method.Name }}).slots)
+	if !slots.acquire(r.Context(), {{ .Timeout }}) {
+		cfg.Metrics.shed("{{ .Method.Options.URL }}", "{{ .Method.Name }}")
+		w.Header().Set("Retry-After", "1")
+		cfg.writeError(w, r, http.StatusServiceUnavailable, errors.New("overloaded"))
+		return
+	}
+	defer slots.release()
+
+`))
+	// genMethod
+	tplSignature = template.Must(template.New("tplSignature").Funcs(funcMap).Parse(
+		`	// Signature checker ({{ .Options.Signature.Algo }} in {{ .Options.Signature.Header }})
+	rawBody, err := io.ReadAll(r.Body)
+	if err != nil {
+		cfg.writeBodyError(w, r, err, "cant read body")
+		return
+	}
+	r.Body = io.NopCloser(bytes.NewReader(rawBody))
+	sigTimestamp, err := strconv.ParseInt(r.Header.Get("{{ .Options.Signature.TimestampHeader }}"), 10, 64)
+	if err != nil || time.Since(time.Unix(sigTimestamp, 0)).Abs() > {{ .Options.Signature.Window }}*time.Second {
+		cfg.writeError(w, r, http.StatusUnauthorized, errors.New("bad signature timestamp"))
+		return
+	}
+	sigSecret, err := {{ svcExpr }}.SignatureSecret(r, "{{ .Name }}")
+	if err != nil {
+		cfg.writeError(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	sigMAC := hmac.New({{ .Options.Signature.Algo }}.New, sigSecret)
+	sigMAC.Write([]byte(r.Header.Get("{{ .Options.Signature.TimestampHeader }}") + "."))
+	sigMAC.Write(rawBody)
+	sigGot, err := hex.DecodeString(strings.TrimPrefix(r.Header.Get("{{ .Options.Signature.Header }}"), "{{ .Options.Signature.Algo }}="))
+	if err != nil || !hmac.Equal(sigGot, sigMAC.Sum(nil)) {
+		cfg.writeError(w, r, http.StatusUnauthorized, errors.New("bad signature"))
+		return
+	}
+
+`))
+	tplMetricsSupport = template.Must(template.New("tplMetricsSupport").Parse(`
+// apigenLatencyBuckets are upper bounds of the latency histogram in seconds
+var apigenLatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Metrics of generated handlers, labels are the annotation url and the Go method
+// so the number of series is bounded by the generated code
+type Metrics struct {
+	mu     sync.RWMutex
+	routes map[apigenMetricsKey]*apigenRouteMetrics
+}
+
+type apigenMetricsKey struct {
+	route  string
+	method string
+}
+
+type apigenRouteMetrics struct {
+	inFlight atomic.Int64
+	statuses [6]atomic.Uint64 // by status class, 1xx - 5xx, 0 for anything else
+	buckets  []atomic.Uint64  // per latency bucket, the last one is +Inf
+	count    atomic.Uint64
+	sumNanos atomic.Int64
+	shed     atomic.Uint64 // turned away by "max_concurrency"
+}
+
+// DefaultMetrics is what HandlerConfig gets by default and what MetricsHandler serves
+var DefaultMetrics = NewMetrics()
+
+func NewMetrics() *Metrics {
+	return &Metrics{routes: map[apigenMetricsKey]*apigenRouteMetrics{}}
+}
+
+// MetricsHandler serves DefaultMetrics in Prometheus text format
+func MetricsHandler() http.Handler {
+	return DefaultMetrics
+}
+
+// route returns metrics of the route, they are made on the first request
+func (m *Metrics) route(route, method string) *apigenRouteMetrics {
+	key := apigenMetricsKey{route, method}
+	m.mu.RLock()
+	rm := m.routes[key]
+	m.mu.RUnlock()
+	if rm != nil {
+		return rm
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if rm = m.routes[key]; rm == nil {
+		rm = &apigenRouteMetrics{buckets: make([]atomic.Uint64, len(apigenLatencyBuckets)+1)}
+		m.routes[key] = rm
+	}
+	return rm
+}
+
+// start counts the request in flight, nil Metrics do nothing
+func (m *Metrics) start(route, method string) *apigenRouteMetrics {
+	if m == nil {
+		return nil
+	}
+	rm := m.route(route, method)
+	rm.inFlight.Add(1)
+	return rm
+}
+
+// shed counts a request turned away by the concurrency limit, nil Metrics do nothing
+func (m *Metrics) shed(route, method string) {
+	if m == nil {
 		return
-	} 	
+	}
+	m.route(route, method).shed.Add(1)
+}
+
+// done is deferred by wrappers with the result of start
+func (rm *apigenRouteMetrics) done(sw *apigenStatusWriter, start time.Time) {
+	if rm == nil {
+		return
+	}
+	rm.inFlight.Add(-1)
+	status := sw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if class := status / 100; class > 0 && class < len(rm.statuses) {
+		rm.statuses[class].Add(1)
+	} else {
+		rm.statuses[0].Add(1)
+	}
+	latency := time.Since(start)
+	bucket := sort.SearchFloat64s(apigenLatencyBuckets, latency.Seconds())
+	rm.buckets[bucket].Add(1)
+	rm.count.Add(1)
+	rm.sumNanos.Add(int64(latency))
+}
+
+// ServeHTTP writes the metrics in Prometheus text exposition format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.RLock()
+	keys := make([]apigenMetricsKey, 0, len(m.routes))
+	for key := range m.routes {
+		keys = append(keys, key)
+	}
+	m.mu.RUnlock()
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		return keys[i].method < keys[j].method
+	})
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	statusClasses := []string{"other", "1xx", "2xx", "3xx", "4xx", "5xx"}
+
+	fmt.Fprintf(w, "# HELP apigen_requests_total Requests by route, method and status class.\n")
+	fmt.Fprintf(w, "# TYPE apigen_requests_total counter\n")
+	for _, key := range keys {
+		rm := m.route(key.route, key.method)
+		for class := range rm.statuses {
+			if n := rm.statuses[class].Load(); n > 0 {
+				fmt.Fprintf(w, "apigen_requests_total{%s,status=%q} %d\n", key.labels(), statusClasses[class], n)
+			}
+		}
+	}
+	fmt.Fprintf(w, "# HELP apigen_request_duration_seconds Request latency by route and method.\n")
+	fmt.Fprintf(w, "# TYPE apigen_request_duration_seconds histogram\n")
+	for _, key := range keys {
+		rm := m.route(key.route, key.method)
+		cumulative := uint64(0)
+		for i := range rm.buckets {
+			cumulative += rm.buckets[i].Load()
+			le := "+Inf"
+			if i < len(apigenLatencyBuckets) {
+				le = strconv.FormatFloat(apigenLatencyBuckets[i], 'g', -1, 64)
+			}
+			fmt.Fprintf(w, "apigen_request_duration_seconds_bucket{%s,le=%q} %d\n", key.labels(), le, cumulative)
+		}
+		fmt.Fprintf(w, "apigen_request_duration_seconds_sum{%s} %g\n", key.labels(), time.Duration(rm.sumNanos.Load()).Seconds())
+		fmt.Fprintf(w, "apigen_request_duration_seconds_count{%s} %d\n", key.labels(), rm.count.Load())
+	}
+	fmt.Fprintf(w, "# HELP apigen_requests_in_flight Requests being served by route and method.\n")
+	fmt.Fprintf(w, "# TYPE apigen_requests_in_flight gauge\n")
+	for _, key := range keys {
+		fmt.Fprintf(w, "apigen_requests_in_flight{%s} %d\n", key.labels(), m.route(key.route, key.method).inFlight.Load())
+	}
+	fmt.Fprintf(w, "# HELP apigen_requests_shed_total Requests turned away by the concurrency limit by route and method.\n")
+	fmt.Fprintf(w, "# TYPE apigen_requests_shed_total counter\n")
+	for _, key := range keys {
+		if n := m.route(key.route, key.method).shed.Load(); n > 0 {
+			fmt.Fprintf(w, "apigen_requests_shed_total{%s} %d\n", key.labels(), n)
+		}
+	}
+}
+
+var apigenLabelEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+func (key apigenMetricsKey) labels() string {
+	return "route=\"" + apigenLabelEscaper.Replace(key.route) + "\",method=\"" + apigenLabelEscaper.Replace(key.method) + "\""
+}
+`))
+	tplTracingSupport = template.Must(template.New("tplTracingSupport").Parse(`
+// SpanContext is the W3C trace context of a span
+type SpanContext struct {
+	TraceID    [16]byte
+	SpanID     [8]byte
+	Flags      byte
+	TraceState string
+}
+
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceParent is sc as the traceparent header
+func (sc SpanContext) TraceParent() string {
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// ParseTraceParent reads traceparent and tracestate headers, ok is false if traceparent is bad
+func ParseTraceParent(traceParent, traceState string) (sc SpanContext, ok bool) {
+	parts := strings.Split(traceParent, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || parts[0] == "00" && len(parts) != 4 ||
+		len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	var flags [1]byte
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(flags[:], []byte(parts[3])); err != nil {
+		return SpanContext{}, false
+	}
+	sc.Flags = flags[0]
+	sc.TraceState = traceState
+	return sc, sc.IsValid()
+}
+
+// Span is a started span of a Tracer
+type Span interface {
+	SpanContext() SpanContext
+	SetAttribute(key string, value any)
+	RecordError(err error)
+	SetStatus(status int) // HTTP status of the response
+	End()
+}
+
+// Tracer starts spans, parent is invalid when the request has no traceparent
+type Tracer interface {
+	Start(ctx context.Context, name string, parent SpanContext) Span
+}
+
+type apigenSpanKey struct{}
+
+// ContextWithSpan puts span into ctx
+func ContextWithSpan(ctx context.Context, span Span) context.Context {
+	return context.WithValue(ctx, apigenSpanKey{}, span)
+}
+
+// SpanFromContext returns the span of the request, methods of API types get it in ctx.
+// It's a no-op span if there is none
+func SpanFromContext(ctx context.Context) Span {
+	if span, ok := ctx.Value(apigenSpanKey{}).(Span); ok {
+		return span
+	}
+	return apigenNoopSpan{}
+}
+
+func (cfg *HandlerConfig) startSpan(r *http.Request, name, route string) (*http.Request, Span) {
+	parent, _ := ParseTraceParent(r.Header.Get("traceparent"), r.Header.Get("tracestate"))
+	span := cfg.Tracer.Start(r.Context(), name, parent)
+	span.SetAttribute("http.route", route)
+	span.SetAttribute("http.method", r.Method)
+	return r.WithContext(ContextWithSpan(r.Context(), span)), span
+}
+
+// apigenEndSpan is deferred by wrappers, errors of validation, auth and methods
+// and ApiError statuses get to the span
+func apigenEndSpan(span Span, sw *apigenStatusWriter) {
+	status := sw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if sw.err != nil {
+		span.RecordError(sw.err)
+	}
+	span.SetStatus(status)
+	span.End()
+}
+
+// NoopTracer starts spans that do nothing
+type NoopTracer struct{}
+
+func (NoopTracer) Start(ctx context.Context, name string, parent SpanContext) Span {
+	return apigenNoopSpan{parent}
+}
+
+type apigenNoopSpan struct {
+	sc SpanContext
+}
+
+func (span apigenNoopSpan) SpanContext() SpanContext        { return span.sc }
+func (apigenNoopSpan) SetAttribute(key string, value any) {}
+func (apigenNoopSpan) RecordError(err error)              {}
+func (apigenNoopSpan) SetStatus(status int)               {}
+func (apigenNoopSpan) End()                               {}
+
+// RecordingTracer keeps spans in memory, for tests
+type RecordingTracer struct {
+	mu    sync.Mutex
+	spans []*RecordedSpan
+}
+
+// RecordedSpan is a span of RecordingTracer
+type RecordedSpan struct {
+	tracer     *RecordingTracer
+	Name       string
+	Context    SpanContext
+	Parent     SpanContext
+	Attributes map[string]any
+	Errors     []error
+	Status     int
+	Ended      bool
+}
+
+// Start continues the trace of parent or starts a new one
+func (t *RecordingTracer) Start(ctx context.Context, name string, parent SpanContext) Span {
+	span := &RecordedSpan{tracer: t, Name: name, Parent: parent, Attributes: map[string]any{}}
+	span.Context.TraceID = parent.TraceID
+	if !parent.IsValid() {
+		rand.Read(span.Context.TraceID[:])
+	}
+	rand.Read(span.Context.SpanID[:])
+	span.Context.Flags = parent.Flags
+	span.Context.TraceState = parent.TraceState
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+	return span
+}
+
+// Spans returns copies of all started spans
+func (t *RecordingTracer) Spans() []RecordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	spans := make([]RecordedSpan, 0, len(t.spans))
+	for _, span := range t.spans {
+		spans = append(spans, *span)
+	}
+	return spans
+}
+
+func (span *RecordedSpan) SpanContext() SpanContext {
+	return span.Context
+}
+
+func (span *RecordedSpan) SetAttribute(key string, value any) {
+	span.tracer.mu.Lock()
+	span.Attributes[key] = value
+	span.tracer.mu.Unlock()
+}
+
+func (span *RecordedSpan) RecordError(err error) {
+	span.tracer.mu.Lock()
+	span.Errors = append(span.Errors, err)
+	span.tracer.mu.Unlock()
+}
+
+func (span *RecordedSpan) SetStatus(status int) {
+	span.tracer.mu.Lock()
+	span.Status = status
+	span.tracer.mu.Unlock()
+}
+
+func (span *RecordedSpan) End() {
+	span.tracer.mu.Lock()
+	span.Ended = true
+	span.tracer.mu.Unlock()
+}
+`))
+	tplRateLimitSupport = template.Must(template.New("tplRateLimitSupport").Parse(`
+// RateLimitStore keeps token buckets of rate limits, a shared store may be plugged in with WithRateLimitStore.
+// Allow takes a token from the bucket of key or tells when the next one comes
+type RateLimitStore interface {
+	Allow(key string, rps float64, burst int, now time.Time) (ok bool, retryAfter time.Duration)
+}
+
+const (
+	apigenRateLimitShards = 32
+	// DefaultRateLimitKeys is how many clients NewMemoryRateLimitStore keeps buckets of
+	DefaultRateLimitKeys = 128 << 10
+)
+
+// MemoryRateLimitStore keeps token buckets in memory of the process,
+// sharded by key so clients don't wait for each other. Every shard keeps
+// a bounded number of buckets, the least recently used one is dropped for a new key
+type MemoryRateLimitStore struct {
+	shards   [apigenRateLimitShards]apigenRateLimitShard
+	perShard int
+}
+
+type apigenRateLimitShard struct {
+	mu      sync.Mutex
+	buckets map[string]*list.Element // of *apigenTokenBucket
+	lru     list.List                // most recently used first
+}
+
+type apigenTokenBucket struct {
+	key    string
+	tokens float64
+	last   time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return NewMemoryRateLimitStoreSize(DefaultRateLimitKeys)
+}
+
+// NewMemoryRateLimitStoreSize makes a store keeping buckets of about maxKeys clients
+func NewMemoryRateLimitStoreSize(maxKeys int) *MemoryRateLimitStore {
+	store := &MemoryRateLimitStore{perShard: (maxKeys + apigenRateLimitShards - 1) / apigenRateLimitShards}
+	if store.perShard < 1 {
+		store.perShard = 1
+	}
+	for i := range store.shards {
+		store.shards[i].buckets = map[string]*list.Element{}
+	}
+	return store
+}
+
+// Len is the number of kept buckets
+func (store *MemoryRateLimitStore) Len() int {
+	n := 0
+	for i := range store.shards {
+		store.shards[i].mu.Lock()
+		n += len(store.shards[i].buckets)
+		store.shards[i].mu.Unlock()
+	}
+	return n
+}
+
+func (store *MemoryRateLimitStore) Allow(key string, rps float64, burst int, now time.Time) (bool, time.Duration) {
+	// FNV-1a
+	hash := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= 16777619
+	}
+	shard := &store.shards[hash%apigenRateLimitShards]
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+	var bucket *apigenTokenBucket
+	if elem, ok := shard.buckets[key]; ok {
+		shard.lru.MoveToFront(elem)
+		bucket = elem.Value.(*apigenTokenBucket)
+	} else {
+		if len(shard.buckets) >= store.perShard {
+			oldest := shard.lru.Back()
+			shard.lru.Remove(oldest)
+			delete(shard.buckets, oldest.Value.(*apigenTokenBucket).key)
+		}
+		bucket = &apigenTokenBucket{key: key, tokens: float64(burst), last: now}
+		shard.buckets[key] = shard.lru.PushFront(bucket)
+	}
+	if now.After(bucket.last) {
+		bucket.tokens += now.Sub(bucket.last).Seconds() * rps
+		if bucket.tokens > float64(burst) {
+			bucket.tokens = float64(burst)
+		}
+		bucket.last = now
+	}
+	if bucket.tokens < 1 {
+		return false, time.Duration((1 - bucket.tokens) / rps * float64(time.Second))
+	}
+	bucket.tokens--
+	return true, 0
+}
+
+// rateLimited answers 429 with Retry-After in whole seconds
+func (cfg *HandlerConfig) rateLimited(w http.ResponseWriter, r *http.Request, retryAfter time.Duration) {
+	seconds := int64((retryAfter + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+	cfg.writeError(w, r, http.StatusTooManyRequests, errors.New("rate limit exceeded"))
+}
+
+// apigenClientIP is the host of RemoteAddr, put the address of the client there behind proxies
+func apigenClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// apigenSecretKey hashes credentials and API keys, so rate limit stores never keep them
+func apigenSecretKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:16])
+}
+`))
+	tplCORSSupport = template.Must(template.New("tplCORSSupport").Parse(`
+// CORSPolicy is what browsers may do cross-origin, for every method with WithCORS
+// or for one method with "cors" of apigen:api
+type CORSPolicy struct {
+	AllowOrigins     []string // "*" allows any origin
+	AllowMethods     []string // the method of the annotation by default
+	AllowHeaders     []string // "*" allows whatever the preflight asks for
+	ExposeHeaders    []string
+	AllowCredentials bool
+	MaxAge           int // seconds browsers may cache preflights, 0 leaves it to them
+}
+
+// allowOrigin tells if origin may make requests, "*" never allows credentialed ones
+func (policy *CORSPolicy) allowOrigin(origin string) bool {
+	for _, allowed := range policy.AllowOrigins {
+		if allowed == "*" && !policy.AllowCredentials || allowed == origin {
+			return true
+		}
+	}
+	return false
+}
+
+func apigenIsPreflight(r *http.Request) bool {
+	return r.Method == http.MethodOptions && r.Header.Get("Origin") != "" && r.Header.Get("Access-Control-Request-Method") != ""
+}
+
+// apigenPreflightMethod is the method a CORS preflight asks for, r.Method for other requests,
+// routes dispatch by it so preflights get to the wrapper of the method
+func apigenPreflightMethod(r *http.Request) string {
+	if apigenIsPreflight(r) {
+		return r.Header.Get("Access-Control-Request-Method")
+	}
+	return r.Method
+}
+
+// handleCORS decorates responses of cross-origin requests with policy (CORS of cfg if nil)
+// and answers preflights, true means the request is answered.
+// method is the one of the annotation, "" if any
+func (cfg *HandlerConfig) handleCORS(w http.ResponseWriter, r *http.Request, policy *CORSPolicy, method string) bool {
+	if policy == nil {
+		policy = cfg.CORS
+	}
+	origin := r.Header.Get("Origin")
+	if policy == nil || origin == "" {
+		return false
+	}
+	header := w.Header()
+	header.Add("Vary", "Origin")
+	allowed := policy.allowOrigin(origin)
+	if allowed {
+		if policy.AllowCredentials || !apigenContains(policy.AllowOrigins, "*") {
+			header.Set("Access-Control-Allow-Origin", origin)
+		} else {
+			header.Set("Access-Control-Allow-Origin", "*")
+		}
+		if policy.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+	}
+	if !apigenIsPreflight(r) {
+		if allowed && len(policy.ExposeHeaders) > 0 {
+			header.Set("Access-Control-Expose-Headers", strings.Join(policy.ExposeHeaders, ", "))
+		}
+		return false
+	}
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+	if allowed {
+		methods := policy.AllowMethods
+		if len(methods) == 0 && method != "" {
+			methods = []string{method}
+		} else if len(methods) == 0 {
+			methods = []string{r.Header.Get("Access-Control-Request-Method")}
+		}
+		header.Set("Access-Control-Allow-Methods", strings.Join(methods, ", "))
+		if apigenContains(policy.AllowHeaders, "*") {
+			if asked := r.Header.Get("Access-Control-Request-Headers"); asked != "" {
+				header.Set("Access-Control-Allow-Headers", asked)
+			}
+		} else if len(policy.AllowHeaders) > 0 {
+			header.Set("Access-Control-Allow-Headers", strings.Join(policy.AllowHeaders, ", "))
+		}
+		if policy.MaxAge > 0 {
+			header.Set("Access-Control-Max-Age", strconv.Itoa(policy.MaxAge))
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true
+}
+
+func apigenContains(slice []string, str string) bool {
+	for _, have := range slice {
+		if have == str {
+			return true
+		}
+	}
+	return false
+}
+`))
+	tplConcurrencySupport = template.Must(template.New("tplConcurrencySupport").Parse(`
+// apigenConcurrencyLimit is a semaphore of "max_concurrency" methods, every config
+// has its own for each method so floods of one don't starve others
+type apigenConcurrencyLimit chan struct{}
+
+// acquire takes a slot, waiting for it up to wait, false means the call is shed
+func (limit apigenConcurrencyLimit) acquire(ctx context.Context, wait time.Duration) bool {
+	select {
+	case limit <- struct{}{}:
+		return true
+	default:
+	}
+	if wait <= 0 {
+		return false
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case limit <- struct{}{}:
+		return true
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func (limit apigenConcurrencyLimit) release() {
+	<-limit
+}
+`))
+	tplFileSupport = template.Must(template.New("tplFileSupport").Parse(`
+// apigenFileRules are apivalidator rules of a file field
+type apigenFileRules struct {
+	name        string // for errors
+	required    bool
+	maxCount    int
+	maxSize     int64
+	maxSizeText string
+	types       []string // "image/*" allows any image
+}
+
+// apigenFormFiles returns files of the multipart form under key checked by rules,
+// content types are sniffed from the first 512 bytes, not taken from the client
+func apigenFormFiles(r *http.Request, key string, rules apigenFileRules) ([]*multipart.FileHeader, error) {
+	var files []*multipart.FileHeader
+	if r.MultipartForm != nil {
+		files = r.MultipartForm.File[key]
+	}
+	if rules.required && len(files) == 0 {
+		return nil, errors.New(rules.name + " must me not empty")
+	}
+	if rules.maxCount > 0 && len(files) > rules.maxCount {
+		return nil, errors.New(rules.name + " must have at most " + strconv.Itoa(rules.maxCount) + " files")
+	}
+	for _, file := range files {
+		if rules.maxSize > 0 && file.Size > rules.maxSize {
+			return nil, errors.New(rules.name + " must be at most " + rules.maxSizeText)
+		}
+		if len(rules.types) == 0 {
+			continue
+		}
+		contentType, err := apigenSniffContentType(file)
+		if err != nil {
+			return nil, errors.New("cant read " + rules.name)
+		}
+		allowed := false
+		for _, want := range rules.types {
+			if want == contentType || strings.HasSuffix(want, "/*") && strings.HasPrefix(contentType, strings.TrimSuffix(want, "*")) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return nil, errors.New(rules.name + " must be one of [" + strings.Join(rules.types, ", ") + "]")
+		}
+	}
+	return files, nil
+}
+
+// apigenSniffContentType is http.DetectContentType of the file without parameters
+func apigenSniffContentType(file *multipart.FileHeader) (string, error) {
+	f, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	contentType, _, _ := strings.Cut(http.DetectContentType(head[:n]), ";")
+	return contentType, nil
+}
 
+// apigenFirstFile is the file of a single file field, nil if there is none
+func apigenFirstFile(files []*multipart.FileHeader) *multipart.FileHeader {
+	if len(files) == 0 {
+		return nil
+	}
+	return files[0]
+}
+`))
+	tplSignatureSupport = template.Must(template.New("tplSignatureSupport").Parse(`
+// SignatureSecretProvider must be implemented by API types with "signature" methods,
+// method is the name of the Go method being called
+type SignatureSecretProvider interface {
+	SignatureSecret(r *http.Request, method string) ([]byte, error)
+}
 `))
 	tplMethod = template.Must(template.New("tplMethod").Parse(
 		`	// Method checker
 	if r.Method != {{ .Value }} {
-		w.WriteHeader(http.StatusNotAcceptable)
-		data, _ := json.Marshal(resValue{"error": "bad method"})
-		io.WriteString(w, string(data))	
+		cfg.writeError(w, r, http.StatusNotAcceptable, errors.New("bad method"))
 		return
 	}
 
+`))
+
+	tplBadMethod = template.Must(template.New("tplBadMethod").Parse(
+		`		cfg.writeError(w, r, http.StatusNotAcceptable, errors.New("bad method"))
 `))
 
 	tplUnkMethod = template.Must(template.New("tplUnkMethod").Parse(
-		`		w.WriteHeader(http.StatusNotFound)
-		data, _ := json.Marshal(resValue{"error": "unknown method"})
-		io.WriteString(w, string(data))
+		`		if cfg.NotFound != nil {
+			cfg.NotFound.ServeHTTP(w, r)
+			return
+		}
+		cfg.writeError(w, r, http.StatusNotFound, errors.New("unknown method"))
 `))
 
+	// FieldName | ParamName | Value - fields of fileRules
+	tplFileParam = template.Must(template.New("tplFileParam").Parse(
+		`	param{{ .FieldName }}Files, err := apigenFormFiles(r, "{{ .ParamName }}", apigenFileRules{ {{- .Value -}} })
+	if err != nil {
+		cfg.writeError(w, r, http.StatusBadRequest, err)
+		return
+	}
+`))
+	// FieldName | ParamName | Value - where from, "" for the body or the query
 	tplGetParam = template.Must(template.New("tplGetParam").Parse(
-		`	param{{.FieldName}} := r.Form.Get("{{ .ParamName }}")
+		`	param{{.FieldName}} := {{ if eq .Value "query" }}values.query.Get({{ else if eq .Value "body" }}values.body.Get({{ else if eq .Value "header" }}r.Header.Get({{ else if eq .Value "cookie" }}apigenCookieValue(r, {{ else }}values.Get({{ end }}"{{ .ParamName }}")
+`))
+	// FieldName | ParamName | Mux - http.ServeMux is the router
+	tplGetPathParam = template.Must(template.New("tplGetPathParam").Parse(
+		`	param{{.FieldName}} := {{ if .Mux }}r.PathValue({{ else }}PathParam(r, {{ end }}"{{ .ParamName }}")
 `))
 	// FieldName
 	tplRequired = template.Must(template.New("tplUnkMethod").Funcs(funcMap).Parse(
 		`	// tplRequired
 	if param{{ .FieldName }} == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		data, _ := json.Marshal(resValue{"error": "{{ .FieldName | toLower }} must me not empty"})
-		io.WriteString(w, string(data))
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("{{ .FieldName | toLower }} must me not empty"))
 		return
 	}
 
@@ -95,9 +1748,7 @@ func (node *{{ .TypeName }}) wrapper{{ .MethodName }}(w http.ResponseWriter, r *
 		enumFlag = true
 	}
 	{{ end }}if !enumFlag {
-		w.WriteHeader(http.StatusBadRequest)
-		data, _ := json.Marshal(resValue{"error": "{{ .FieldName | toLower }} must be one of [{{ .Slice | joinComma }}]"})
-		io.WriteString(w, string(data))
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("{{ .FieldName | toLower }} must be one of [{{ .Slice | joinComma }}]"))
 		return
 	}
 
@@ -115,21 +1766,15 @@ func (node *{{ .TypeName }}) wrapper{{ .MethodName }}(w http.ResponseWriter, r *
 		`	// tplMin
 	{{ if .IsInt }}param{{ $.FieldName }}IntMin, err := strconv.Atoi(param{{ $.FieldName }})
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		data, _ := json.Marshal(resValue{"error": "{{ $.FieldName | toLower }} must be int"})
-		io.WriteString(w, string(data))
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("{{ $.FieldName | toLower }} must be int"))
 		return
 	}
 	if param{{ .FieldName }}IntMin < {{ .Value }} {
-		w.WriteHeader(http.StatusBadRequest)
-		data, _ := json.Marshal(resValue{"error": "{{ $.FieldName | toLower }} must be >= {{ $.Value }}"})
-		io.WriteString(w, string(data))
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("{{ $.FieldName | toLower }} must be >= {{ $.Value }}"))
 		return 
 	}
 	{{ else }}if len([]rune(param{{ .FieldName }})) < {{ .Value }} {
-		w.WriteHeader(http.StatusBadRequest)
-		data, _ := json.Marshal(resValue{"error": "{{ $.FieldName | toLower }} len must be >= {{ $.Value }}"})
-		io.WriteString(w, string(data))
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("{{ $.FieldName | toLower }} len must be >= {{ $.Value }}"))
 		return 
 	}
 	{{end}}
@@ -139,59 +1784,176 @@ func (node *{{ .TypeName }}) wrapper{{ .MethodName }}(w http.ResponseWriter, r *
 		`	// tplMax
 	{{ if .IsInt }}param{{ $.FieldName }}IntMax, err := strconv.Atoi(param{{ $.FieldName }})
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		data, _ := json.Marshal(resValue{"error": "{{ $.FieldName | toLower }} must be int"})
-		io.WriteString(w, string(data))
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("{{ $.FieldName | toLower }} must be int"))
 		return
 	}
 	if param{{ .FieldName }}IntMax > {{ .Value }} {
-		w.WriteHeader(http.StatusBadRequest)
-		data, _ := json.Marshal(resValue{"error": "{{ $.FieldName | toLower }} must be <= {{ $.Value }}"})
-		io.WriteString(w, string(data))
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("{{ $.FieldName | toLower }} must be <= {{ $.Value }}"))
 		return 
 	}
 	{{ else }}if len([]rune(param{{ .FieldName }})) > {{ .Value }} {
-		w.WriteHeader(http.StatusBadRequest)
-		data, _ := json.Marshal(resValue{"error": "{{ .FieldName | toLower}} len must be <= {{ $.Value }}"})
-		io.WriteString(w, string(data))
+		cfg.writeError(w, r, http.StatusBadRequest, errors.New("{{ .FieldName | toLower}} len must be <= {{ $.Value }}"))
 		return 
 	}
 	{{ end }}
 `))
 
+	// Value - receiver | MethodName | Timeout - of the annotation
 	tplResponseMethod = template.Must(template.New("tplResponseMethod").Parse(
-		`	ctx := r.Context()
-	response, err := node.{{ .MethodName }}(ctx, params)
+		`	ctx, cancel := cfg.methodContext(r, {{ .Timeout }})
+	defer cancel()
+	response, err := {{ .Value }}.{{ .MethodName }}(ctx, params)
 	if err != nil {
 		switch err.(type) {
 		case ApiError:
-			data, _ := json.Marshal(resValue{"error": err.(ApiError).Err.Error()})
-			w.WriteHeader(err.(ApiError).HTTPStatus)
-			io.WriteString(w, string(data))
+			cfg.writeError(w, r, err.(ApiError).HTTPStatus, err)
 		default:
-			data, _ := json.Marshal(resValue{"error": err.Error()})
-			w.WriteHeader(http.StatusInternalServerError)
-			io.WriteString(w, string(data))
+			if errors.Is(err, context.DeadlineExceeded) && ctx.Err() != nil {
+				cfg.writeError(w, r, http.StatusGatewayTimeout, errors.New("timeout"))
+				return
+			}
+			cfg.Logger.Error("method failed", "method", "{{ .MethodName }}", "request_id", RequestIDFromContext(ctx), "error", err)
+			cfg.writeError(w, r, http.StatusInternalServerError, err)
 		}
 		return
 	}
-	data, _ := json.Marshal(resValue{"error": "", "response": response})
+	data, _ := json.Marshal(apigenResValue{"error": "", "response": response})
 	w.WriteHeader(http.StatusOK)
 	io.WriteString(w, string(data))	
 `))
 )
 
 type methodOptions struct {
-	URL    string `json:"url"`
-	Auth   bool   `json:"auth"`
-	Method string `json:"method"`
+	URL        string           `json:"url"`
+	Auth       bool             `json:"auth"`
+	AuthScheme string           `json:"auth_scheme"`
+	Method     string           `json:"method"`
+	Signature  signatureOptions `json:"signature"`
+	Middleware []string         `json:"middleware"` // names from the middleware registry of HandlerConfig
+	RateLimit  rateLimitOptions `json:"rate_limit"`
+	Timeout    duration         `json:"timeout"` // bound of the method ctx like "2s"
+
+	MaxConcurrency int      `json:"max_concurrency"` // calls of the method at once, 0 is no limit
+	QueueWait      duration `json:"queue_wait"`      // how long a call over the limit waits for a slot
+
+	CORS corsOptions `json:"cors"` // methods without it follow CORS of HandlerConfig
+
+	MaxBody byteSize `json:"max_body"` // body limit like "64KB", MaxBodySize of HandlerConfig if 0
+}
+
+// clone copies opts with its slices, json.Unmarshal of a method over the service
+// defaults reuses their arrays otherwise and changes them for every other method
+func (opts methodOptions) clone() methodOptions {
+	opts.Middleware = append([]string(nil), opts.Middleware...)
+	opts.CORS.Origins = append([]string(nil), opts.CORS.Origins...)
+	opts.CORS.Methods = append([]string(nil), opts.CORS.Methods...)
+	opts.CORS.Headers = append([]string(nil), opts.CORS.Headers...)
+	opts.CORS.ExposeHeaders = append([]string(nil), opts.CORS.ExposeHeaders...)
+	return opts
+}
+
+// CORSPolicy of the method, see the generated type
+type corsOptions struct {
+	Origins       []string `json:"origins"`
+	Methods       []string `json:"methods"`
+	Headers       []string `json:"headers"`
+	ExposeHeaders []string `json:"expose_headers"`
+	Credentials   bool     `json:"credentials"`
+	MaxAge        int      `json:"max_age"` // seconds
+}
+
+// byteSize is a number of bytes read from "64KB" like JSON strings or numbers
+type byteSize int64
+
+var byteUnits = map[string]int64{"": 1, "B": 1, "KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30}
+
+func (size *byteSize) UnmarshalJSON(data []byte) error {
+	str := strings.ToUpper(strings.TrimSpace(strings.Trim(string(data), `"`)))
+	digits := strings.TrimRight(str, "BKMG ")
+	n, err := strconv.ParseInt(digits, 10, 64)
+	unit, ok := byteUnits[strings.TrimSpace(str[len(digits):])]
+	if err != nil || !ok || n <= 0 {
+		return fmt.Errorf("%w: size %s", errBadOption, data)
+	}
+	*size = byteSize(n * unit)
+	return nil
+}
+
+// duration is time.Duration read from "2s" like JSON strings
+type duration time.Duration
+
+// errBadOption is returned by options with a value that can't be parsed
+var errBadOption = errors.New("bad option")
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		return fmt.Errorf("%w: duration %s", errBadOption, data)
+	}
+	parsed, err := time.ParseDuration(str)
+	if err != nil || parsed <= 0 {
+		return fmt.Errorf("%w: duration %s", errBadOption, data)
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+// token bucket of the method for every client, clients are told apart by Key:
+// ip (remote address), principal (credential of auth) or header:<Name>
+type rateLimitOptions struct {
+	RPS   float64 `json:"rps"`
+	Burst int     `json:"burst"` // ceil(rps) by default
+	Key   string  `json:"key"`   // ip by default
 }
 
+// options of apigen:service on the receiver type, all methods of the type
+// get Prefix before their URL and take the rest as defaults
+type serviceOptions struct {
+	Prefix string `json:"prefix"`
+	methodOptions
+}
+
+// HMAC of "<timestamp>.<raw body>" made with a secret from SignatureSecret
+// of the API type, hex encoded with optional "<algo>=" prefix
+type signatureOptions struct {
+	Header          string `json:"header"`           // X-Signature by default
+	Algo            string `json:"algo"`             // sha256 by default
+	TimestampHeader string `json:"timestamp_header"` // unix seconds, X-Timestamp by default
+	Window          int    `json:"window"`           // max timestamp skew in seconds, 300 by default
+}
+
+// signature algo -> package with New
+var signatureAlgos = map[string]string{
+	"sha1":   "crypto/sha1",
+	"sha256": "crypto/sha256",
+	"sha512": "crypto/sha512",
+}
+
+// where tplAuth reads the credential from
+var authSchemes = map[string]bool{
+	"header": true, // X-Auth header
+	"basic":  true, // HTTP Basic
+	"query":  true, // ?api_key=
+	"cookie": true, // api_key cookie
+}
+
+var genHandlerType = flag.Bool("handler-type", false, "generate wrappers and ServeHTTP on <Type>Handler made by New<Type>Handler instead of the API type")
+
+var genMux = flag.Bool("mux", false, "generate Register<Type>(mux, svc) for Go 1.22 http.ServeMux patterns instead of ServeHTTP")
+
+var genRouter = flag.Bool("router", false, "generate Router with NewRouter mounting all API types of the file together")
+
+var paramIn = flag.String("param-in", "", `where params without in= are read from (query|body|header|cookie), the body or the query if empty`)
+
+var authScheme = flag.String("auth-scheme", "header", `default auth scheme for methods with "auth": true (header|basic|query|cookie)`)
+
 type genMethod struct {
 	Name      string        // method name
+	Recv      string        // receiver type name
 	Node      *ast.FuncDecl // method node
 	ValidName string        // second param (for validation) name
 	Options   methodOptions // getted JSON options from comment
+	Params    []field       // fields of ValidName
 }
 
 type tag struct {
@@ -202,10 +1964,382 @@ type tag struct {
 type field struct {
 	FieldName string
 	ParamName string
+	In        string // in= of the tag, where the value is read from
 	IsInt     bool
+	File      bool // *multipart.FileHeader or []*multipart.FileHeader
+	Multi     bool // slice of files
 	Tags      []tag
 }
 
+// tags only file fields have
+var fileTags = map[string]bool{
+	"max_size":  true, // of every file like 1MB
+	"max_count": true,
+	"types":     true, // sniffed content types like image/png|image/*
+}
+
+// isFileHeader tells if typ is *multipart.FileHeader
+func isFileHeader(typ ast.Expr) bool {
+	star, ok := typ.(*ast.StarExpr)
+	if !ok {
+		return false
+	}
+	sel, ok := star.X.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	pkg, ok := sel.X.(*ast.Ident)
+	return ok && pkg.Name == "multipart" && sel.Sel.Name == "FileHeader"
+}
+
+// where in= of apivalidator may read params from
+var paramSources = map[string]bool{
+	"query":  true, // the query string
+	"body":   true, // the form or JSON body
+	"header": true, // paramname is the header name
+	"cookie": true,
+	"path":   true, // {paramname} segment of the url
+}
+
+func contains(slice []string, item string) bool {
+	for _, have := range slice {
+		if have == item {
+			return true
+		}
+	}
+	return false
+}
+
+func addImport(importList []string, items ...string) []string {
+	for _, item := range items {
+		if !contains(importList, item) {
+			importList = append(importList, item)
+		}
+	}
+	return importList
+}
+
+// how many {name} segments a route can have, same constant goes to the generated code
+const maxPathParams = 8
+
+// route is one path of the router, methods share it when they differ by verb
+type route struct {
+	ID         int
+	Pattern    string   // URL of the first method
+	ParamNames []string // names of {name} segments in order
+	Methods    []genMethod
+}
+
+// routeNode is the generator side of routeNode from the generated code
+type routeNode struct {
+	Static   map[string]*routeNode
+	Param    *routeNode
+	Route    int
+	CatchAll int
+}
+
+// patternParams splits URL to segments and finds names of {name} and {name...} segments
+func patternParams(pattern string) (segments []string, names []string) {
+	segments = strings.Split(strings.TrimPrefix(pattern, "/"), "/")
+	for _, segment := range segments {
+		if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+			names = append(names, strings.TrimSuffix(segment[1:len(segment)-1], "..."))
+		}
+	}
+	return segments, names
+}
+
+// insert puts route id to the tree if there is no route on this place yet,
+// returns the route that is there after all
+func (node *routeNode) insert(segments []string, id int) (int, error) {
+	segment := segments[0]
+	if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "...}") {
+		if len(segments) != 1 {
+			return 0, fmt.Errorf("%s must be the last segment", segment)
+		}
+		if node.CatchAll == 0 {
+			node.CatchAll = id
+		}
+		return node.CatchAll, nil
+	}
+	var child *routeNode
+	if strings.HasPrefix(segment, "{") && strings.HasSuffix(segment, "}") {
+		if node.Param == nil {
+			node.Param = &routeNode{}
+		}
+		child = node.Param
+	} else {
+		if node.Static == nil {
+			node.Static = map[string]*routeNode{}
+		}
+		if node.Static[segment] == nil {
+			node.Static[segment] = &routeNode{}
+		}
+		child = node.Static[segment]
+	}
+	if len(segments) > 1 {
+		return child.insert(segments[1:], id)
+	}
+	if child.Route == 0 {
+		child.Route = id
+	}
+	return child.Route, nil
+}
+
+// literal is the tree as Go code
+func (node *routeNode) literal(indent string) string {
+	fields := []string{}
+	if len(node.Static) > 0 {
+		keys := make([]string, 0, len(node.Static))
+		for key := range node.Static {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		static := "static: map[string]*apigenRouteNode{\n"
+		for _, key := range keys {
+			static += fmt.Sprintf("%s\t%q: %s,\n", indent, key, node.Static[key].literal(indent+"\t"))
+		}
+		fields = append(fields, static+indent+"}")
+	}
+	if node.Param != nil {
+		fields = append(fields, "param: &apigenRouteNode"+node.Param.literal(indent))
+	}
+	if node.Route != 0 {
+		fields = append(fields, fmt.Sprintf("route: %d", node.Route))
+	}
+	if node.CatchAll != 0 {
+		fields = append(fields, fmt.Sprintf("catchAll: %d", node.CatchAll))
+	}
+	return "{" + strings.Join(fields, ", ") + "}"
+}
+
+// buildRoutes puts URLs of the methods to the segment tree. Methods that land on
+// the same route must have the same {name} segments and different verbs,
+// every conflict is reported with positions of both methods
+func buildRoutes(methods []genMethod, fset *token.FileSet) (*routeNode, []*route) {
+	tree := &routeNode{}
+	routes := []*route{}
+	conflicts := []string{}
+	for _, method := range methods {
+		segments, names := patternParams(method.Options.URL)
+		if len(names) > maxPathParams {
+			log.Fatalf("%s: %s has more than %d path params", fset.Position(method.Node.Pos()), method.Options.URL, maxPathParams)
+		}
+		id, err := tree.insert(segments, len(routes)+1)
+		if err != nil {
+			log.Fatalf("%s: bad url %s: %s", fset.Position(method.Node.Pos()), method.Options.URL, err)
+		}
+		if id > len(routes) {
+			routes = append(routes, &route{ID: id, Pattern: method.Options.URL, ParamNames: names})
+		}
+		for _, other := range routes[id-1].Methods {
+			switch {
+			case strings.Join(names, ",") != strings.Join(routes[id-1].ParamNames, ","):
+				conflicts = append(conflicts, fmt.Sprintf("%s: %s.%s %s is ambiguous with %s.%s %s at %s",
+					fset.Position(method.Node.Pos()), method.Recv, method.Name, method.Options.URL,
+					other.Recv, other.Name, other.Options.URL, fset.Position(other.Node.Pos())))
+			case method.Options.Method == other.Options.Method:
+				conflicts = append(conflicts, fmt.Sprintf("%s: %s.%s %q %s duplicates %s.%s at %s",
+					fset.Position(method.Node.Pos()), method.Recv, method.Name, method.Options.Method, method.Options.URL,
+					other.Recv, other.Name, fset.Position(other.Node.Pos())))
+			default:
+				continue
+			}
+			break
+		}
+		routes[id-1].Methods = append(routes[id-1].Methods, method)
+	}
+	if len(conflicts) > 0 {
+		log.Fatalf("route conflicts:\n\t%s", strings.Join(conflicts, "\n\t"))
+	}
+	return tree, routes
+}
+
+// handlerCfg is the config that typeName handlers use
+func handlerCfg(typeName string, fields map[string]string) string {
+	if fields == nil && !*genHandlerType {
+		return "&DefaultHandlerConfig"
+	}
+	return "&node.cfg"
+}
+
+// routesGen writes Routes of typeName, fields are the same as for serveGen
+func routesGen(out io.Writer, typeName string, routes []*route, fields map[string]string) {
+	type routeMethod struct {
+		genMethod
+		Field  string
+		Params []struct{ Name, In string }
+	}
+	methods := []routeMethod{}
+	for _, route := range routes {
+		for _, method := range route.Methods {
+			field := ""
+			if fields != nil {
+				field = fields[method.Recv] + "."
+			}
+			params := []struct{ Name, In string }{}
+			_, pathParams := patternParams(method.Options.URL)
+			for _, field := range method.Params {
+				params = append(params, struct{ Name, In string }{fieldParamName(field), fieldIn(field, pathParams)})
+			}
+			methods = append(methods, routeMethod{method, field, params})
+		}
+	}
+	tplRoutes.Execute(out, struct {
+		TypeName string
+		Cfg      string
+		Methods  []routeMethod
+	}{typeName, handlerCfg(typeName, fields), methods})
+}
+
+// serveGen writes the routes tree and ServeHTTP of typeName. fields are the
+// fields of typeName holding API types, nil when typeName is the API type itself
+func serveGen(out io.Writer, typeName string, tree *routeNode, routes []*route, fields map[string]string) {
+	fmt.Fprintf(out, "\n// routes of %s\nvar apigenRoutes%s = &apigenRouteNode%s\n", typeName, typeName, tree.literal(""))
+	serveTplOpen.Execute(out, tpl{TypeName: typeName})
+	tplRouting.Execute(out, tpl{TypeName: typeName, Value: handlerCfg(typeName, fields)})
+	callTpl := func(method genMethod, paramNames []string) tpl {
+		field := ""
+		if fields != nil {
+			field = fields[method.Recv] + "."
+		}
+		return tpl{Value: field, MethodName: method.Name, Slice: paramNames}
+	}
+	for _, route := range routes {
+		fmt.Fprintf(out, "\tcase %d: // %s\n", route.ID, route.Pattern)
+		if len(route.Methods) == 1 {
+			tplServeHTTP.Execute(out, callTpl(route.Methods[0], route.ParamNames))
+			continue
+		}
+		// same path, different verbs
+		fmt.Fprintf(out, "\t\tswitch apigenPreflightMethod(r) {\n")
+		anyMethod := -1
+		for i, method := range route.Methods {
+			if method.Options.Method == "" {
+				anyMethod = i
+				continue
+			}
+			fmt.Fprintf(out, "\t\tcase %q:\n", method.Options.Method)
+			tplServeHTTP.Execute(out, callTpl(method, route.ParamNames))
+		}
+		fmt.Fprintf(out, "\t\tdefault:\n")
+		if anyMethod >= 0 {
+			tplServeHTTP.Execute(out, callTpl(route.Methods[anyMethod], route.ParamNames))
+		} else {
+			tplBadMethod.Execute(out, tpl{})
+		}
+		fmt.Fprintf(out, "\t\t}\n")
+	}
+	fmt.Fprintf(out, "\tdefault:\n")
+	tplUnkMethod.Execute(out, tpl{})
+	fmt.Fprintf(out, "\t}\n")
+	serveTplClose.Execute(out, tpl{})
+}
+
+// registerGen writes Register<structName> adding routes to http.ServeMux
+func registerGen(out io.Writer, structName string, routes []*route) {
+	patterns := []tpl{}
+	// OPTIONS patterns sending CORS preflights to the method they ask for
+	preflights := []tpl{}
+	for _, route := range routes {
+		path := route.Pattern
+		// http.ServeMux treats trailing slash as a prefix
+		if strings.HasSuffix(path, "/") {
+			path += "{$}"
+		}
+		preflight := tpl{Value: http.MethodOptions + " " + path}
+		for _, method := range route.Methods {
+			pattern := path
+			if method.Options.Method != "" {
+				pattern = method.Options.Method + " " + pattern
+			}
+			patterns = append(patterns, tpl{Value: pattern, MethodName: method.Name})
+			if method.Options.Method == "" || method.Options.Method == http.MethodOptions {
+				preflight.Value = ""
+			} else if preflight.Value != "" {
+				preflight.Slice = append(preflight.Slice, method.Options.Method, method.Name)
+			}
+		}
+		if preflight.Value != "" {
+			preflights = append(preflights, preflight)
+		}
+	}
+	tplRegister.Execute(out, struct {
+		TypeName   string
+		Handler    bool
+		Patterns   []tpl
+		Preflights []tpl
+	}{structName, *genHandlerType, patterns, preflights})
+}
+
+// methodExpr is the net/http constant of method or a string literal for other verbs
+func methodExpr(method string) string {
+	switch method {
+	case http.MethodGet:
+		return "http.MethodGet"
+	case http.MethodHead:
+		return "http.MethodHead"
+	case http.MethodPost:
+		return "http.MethodPost"
+	case http.MethodPut:
+		return "http.MethodPut"
+	case http.MethodPatch:
+		return "http.MethodPatch"
+	case http.MethodDelete:
+		return "http.MethodDelete"
+	case http.MethodOptions:
+		return "http.MethodOptions"
+	}
+	return strconv.Quote(method)
+}
+
+// handlerType is the type that gets wrappers and ServeHTTP for API type structName
+func handlerType(structName string) string {
+	if *genHandlerType {
+		return structName + "Handler"
+	}
+	return structName
+}
+
+// svcExpr is the API value inside wrappers
+func svcExpr() string {
+	if *genHandlerType {
+		return "node.svc"
+	}
+	return "node"
+}
+
+func lowerFirst(name string) string {
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+func hasSignature(methods []genMethod) bool {
+	for _, method := range methods {
+		if method.Options.Signature.Header != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func hasFiles(fields []field) bool {
+	for _, field := range fields {
+		if field.File {
+			return true
+		}
+	}
+	return false
+}
+
+func hasConcurrency(methods []genMethod) bool {
+	for _, method := range methods {
+		if method.Options.MaxConcurrency > 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func typeName(typ ast.Expr) string {
 	if p, ok := typ.(*ast.StarExpr); ok {
 		typ = p.X
@@ -237,16 +2371,61 @@ var (
 	}
 )
 
-func validGen(out *os.File, name string, fields []field) {
+// fieldIn is where the field is read from: path for fields named like {segments}
+// of the url, in= of the tag, -param-in default or "" for the body or the query
+func fieldIn(field field, pathParams []string) string {
+	if field.File {
+		return "body"
+	}
+	if field.In == "" && contains(pathParams, fieldParamName(field)) {
+		return "path"
+	}
+	if field.In == "" {
+		return *paramIn
+	}
+	return field.In
+}
+
+// fieldParamName is paramname of the field, its lowercase name by default
+func fieldParamName(field field) string {
+	if field.ParamName != "" {
+		return field.ParamName
+	}
+	return strings.ToLower(field.FieldName)
+}
+
+func validGen(out io.Writer, name string, fields []field, pathParams []string) {
 	fmt.Printf("\t\tgenerating validation of params for %s\n\n", name)
 	fmt.Fprintf(out, "\t// validation %s\n", name)
-	fmt.Fprintf(out, "\tr.ParseForm()\n")
+	bind, values, params := false, "", []string{}
+	for _, field := range fields {
+		if in := fieldIn(field, pathParams); in == "" || in == "query" || in == "body" {
+			// files are read from r.MultipartForm, not the values
+			bind = true
+			if !field.File {
+				values = "values"
+				params = append(params, fieldParamName(field))
+			}
+		}
+	}
+	if bind {
+		tplParseForm.Execute(out, tpl{Value: values, Slice: params})
+	}
 	for _, field := range fields {
-		paramname := strings.ToLower(field.FieldName)
-		if field.ParamName != "" {
-			paramname = field.ParamName
+		paramname := fieldParamName(field)
+		if field.File {
+			fileGen(out, field)
+			continue
+		}
+		if in := fieldIn(field, pathParams); in == "path" {
+			tplGetPathParam.Execute(out, struct {
+				FieldName string
+				ParamName string
+				Mux       bool
+			}{field.FieldName, paramname, *genMux})
+		} else {
+			tplGetParam.Execute(out, tpl{FieldName: field.FieldName, ParamName: paramname, Value: in})
 		}
-		tplGetParam.Execute(out, tpl{FieldName: field.FieldName, ParamName: paramname})
 		sort.Slice(field.Tags, func(i, j int) bool {
 			return validPriority[field.Tags[i].Name] < validPriority[field.Tags[j].Name]
 		})
@@ -269,69 +2448,210 @@ func validGen(out *os.File, name string, fields []field) {
 	}
 }
 
-func responseGen(out *os.File, methodName string, name string, fields []field) {
+// fileGen writes binding and checks of a file field
+func fileGen(out io.Writer, field field) {
+	rules := []string{fmt.Sprintf("name: %q", strings.ToLower(field.FieldName))}
+	for _, curTag := range field.Tags {
+		switch curTag.Name {
+		case "required":
+			rules = append(rules, "required: true")
+		case "max_count":
+			if n, err := strconv.Atoi(curTag.Value); err != nil || n < 1 {
+				log.Fatalf("bad max_count=%s of %s", curTag.Value, field.FieldName)
+			}
+			rules = append(rules, "maxCount: "+curTag.Value)
+		case "max_size":
+			var size byteSize
+			if err := size.UnmarshalJSON([]byte(strconv.Quote(curTag.Value))); err != nil {
+				log.Fatalf("bad max_size=%s of %s", curTag.Value, field.FieldName)
+			}
+			rules = append(rules, fmt.Sprintf("maxSize: %d", size), fmt.Sprintf("maxSizeText: %q", curTag.Value))
+		case "types":
+			rules = append(rules, fmt.Sprintf("types: []string{\"%s\"}", strings.Join(strings.Split(curTag.Value, "|"), `", "`)))
+		}
+	}
+	tplFileParam.Execute(out, tpl{FieldName: field.FieldName, ParamName: fieldParamName(field), Value: strings.Join(rules, ", ")})
+}
+
+// durationExpr is d as Go code, "2 * time.Second" for 2s
+func durationExpr(d time.Duration) string {
+	switch {
+	case d == 0:
+		return "0"
+	case d%time.Second == 0:
+		return fmt.Sprintf("%d * time.Second", d/time.Second)
+	case d%time.Millisecond == 0:
+		return fmt.Sprintf("%d * time.Millisecond", d/time.Millisecond)
+	}
+	return fmt.Sprintf("%d", d)
+}
+
+func responseGen(out io.Writer, method genMethod, fields []field) {
 	for _, field := range fields {
 		if field.IsInt {
 			fmt.Fprintf(out, "\tparam%sInt, _ := strconv.Atoi(param%s)\n", field.FieldName, field.FieldName)
 		}
 	}
-	fmt.Fprintf(out, "\tparams := %s{\n", name)
+	fmt.Fprintf(out, "\tparams := %s{\n", method.ValidName)
 	for _, field := range fields {
-		fmt.Fprintf(out, "\t\t%s: param%s", field.FieldName, field.FieldName)
+		switch {
+		case field.File && field.Multi:
+			fmt.Fprintf(out, "\t\t%s: param%sFiles", field.FieldName, field.FieldName)
+		case field.File:
+			fmt.Fprintf(out, "\t\t%s: apigenFirstFile(param%sFiles)", field.FieldName, field.FieldName)
+		default:
+			fmt.Fprintf(out, "\t\t%s: param%s", field.FieldName, field.FieldName)
+		}
 		if field.IsInt {
 			fmt.Fprintf(out, "Int")
 		}
 		fmt.Fprintf(out, ",\n")
 	}
 	fmt.Fprintf(out, "\t}\n")
-	tplResponseMethod.Execute(out, tpl{MethodName: methodName})
+	tplResponseMethod.Execute(out, tpl{Value: svcExpr(), MethodName: method.Name, Timeout: durationExpr(time.Duration(method.Options.Timeout))})
 }
 
 func main() {
+	flag.Parse()
+	if flag.NArg() != 2 {
+		log.Fatalf("usage: %s [flags] ur_code.go output_file_name.go", os.Args[0])
+	}
+	if !authSchemes[*authScheme] {
+		log.Fatalf("unknown auth scheme %q", *authScheme)
+	}
+	if *paramIn != "" && (!paramSources[*paramIn] || *paramIn == "path") {
+		log.Fatalf("unknown param source %q", *paramIn)
+	}
+	if *genMux && *genRouter {
+		log.Fatalf("-mux and -router can't be used together, register all types on one mux instead")
+	}
+
 	in := token.NewFileSet()
 
-	node, err := parser.ParseFile(in, os.Args[1], nil, parser.ParseComments)
+	node, err := parser.ParseFile(in, flag.Arg(0), nil, parser.ParseComments)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	out, _ := os.Create(os.Args[2])
-
-	// IMPORT LIST
+	// IMPORT LIST, the code below adds what it uses
 	importList := []string{"strconv", "encoding/json", "io", "net/http"}
-	fmt.Fprintln(out, `package `+node.Name.Name)
-	fmt.Fprintln(out)
-	fmt.Fprintln(out, "import (")
-	for _, item := range importList {
-		fmt.Fprintln(out, `	"`+item+`"`)
-	}
-	fmt.Fprintln(out, ")")
+	// generated code goes here first, it's written after the imports
+	out := &bytes.Buffer{}
 
 	mapStrMethod := make(map[string][]genMethod)
+	typeOrder := []string{} // keys of mapStrMethod in source order
 	mapStrByName := make(map[string](*ast.StructType))
 	mapGenValid := make(map[string]bool)
 	fmt.Printf("Reading file...\n\n")
+	// apigen:service comes first, methods take defaults from it
+	mapServices := make(map[string]serviceOptions)
+	for _, decl := range node.Decls {
+		if genNode, ok := decl.(*ast.GenDecl); ok && genNode.Tok == token.TYPE {
+			for _, spec := range genNode.Specs {
+				typeNode := spec.(*ast.TypeSpec)
+				doc := typeNode.Doc
+				if doc == nil && len(genNode.Specs) == 1 {
+					doc = genNode.Doc
+				}
+				// the usual "MyApi is ..." doc may go before the annotation
+				if i := strings.Index(doc.Text(), "apigen:service "); i == 0 || i > 0 && doc.Text()[i-1] == '\n' {
+					strJson, _, _ := strings.Cut(doc.Text()[i+len("apigen:service "):], "\n")
+					service := serviceOptions{}
+					if err := json.Unmarshal([]byte(strJson), &service); err != nil {
+						log.Fatalf("%s: cant UNPACK apigen:service of %s: %s", in.Position(typeNode.Pos()), typeNode.Name.Name, err)
+					}
+					if service.URL != "" {
+						log.Fatalf("%s: apigen:service of %s has url, use prefix", in.Position(typeNode.Pos()), typeNode.Name.Name)
+					}
+					fmt.Printf("\tgetted service JSON from: %s\n\t%#v\n\n", typeNode.Name.Name, service)
+					mapServices[typeNode.Name.Name] = service
+				}
+			}
+		}
+	}
 	for _, decl := range node.Decls {
 		if now, ok := decl.(*ast.FuncDecl); ok {
 			if now.Recv != nil {
 				if strings.HasPrefix(now.Doc.Text(), "apigen:api ") {
 					strJson := now.Doc.Text()[len("apigen:api "):]
-					data := methodOptions{}
+					service := mapServices[typeName(now.Recv.List[0].Type)]
+					// options that are not in the comment stay as the service set them
+					data := service.methodOptions.clone()
 					err := json.Unmarshal([]byte(strJson), &data)
+					data.URL = strings.TrimSuffix(service.Prefix, "/") + data.URL
 					fmt.Printf("\tcommented JSON: %s", strJson)
+					// a dropped option could be a rate limit or a signature, never go on without it
 					if err != nil {
-						fmt.Printf("\tcant UNPACK from JSON to DATA: %s\n\n", now.Name.Name)
-					} else {
-						fmt.Printf("\tgetted JSON from: %s\n", now.Name.Name)
-						fmt.Printf("\t%#v\n\n", data)
+						log.Fatalf("%s: cant UNPACK apigen:api of %s: %s", in.Position(now.Pos()), now.Name.Name, err)
+					}
+					fmt.Printf("\tgetted JSON from: %s\n", now.Name.Name)
+					fmt.Printf("\t%#v\n\n", data)
+					data.Method = strings.ToUpper(data.Method)
+					if data.Auth && data.AuthScheme == "" {
+						data.AuthScheme = *authScheme
+					}
+					if data.Auth && !authSchemes[data.AuthScheme] {
+						log.Fatalf("%s: unknown auth scheme %q for %s", in.Position(now.Pos()), data.AuthScheme, now.Name.Name)
+					}
+					if data.Signature != (signatureOptions{}) {
+						if data.Signature.Header == "" {
+							data.Signature.Header = "X-Signature"
+						}
+						if data.Signature.Algo == "" {
+							data.Signature.Algo = "sha256"
+						}
+						if data.Signature.TimestampHeader == "" {
+							data.Signature.TimestampHeader = "X-Timestamp"
+						}
+						if data.Signature.Window == 0 {
+							data.Signature.Window = 300
+						}
+						if signatureAlgos[data.Signature.Algo] == "" {
+							log.Fatalf("%s: unknown signature algo %q for %s", in.Position(now.Pos()), data.Signature.Algo, now.Name.Name)
+						}
+					}
+					if len(data.CORS.Origins) == 0 && (len(data.CORS.Methods) > 0 || len(data.CORS.Headers) > 0 ||
+						len(data.CORS.ExposeHeaders) > 0 || data.CORS.Credentials || data.CORS.MaxAge != 0) {
+						log.Fatalf("%s: cors of %s has no origins", in.Position(now.Pos()), now.Name.Name)
+					}
+					if data.CORS.Credentials && contains(data.CORS.Origins, "*") {
+						log.Fatalf("%s: cors of %s allows credentials from any origin, list the origins", in.Position(now.Pos()), now.Name.Name)
+					}
+					if data.MaxConcurrency < 0 {
+						log.Fatalf("%s: max_concurrency of %s is negative", in.Position(now.Pos()), now.Name.Name)
+					}
+					if data.RateLimit != (rateLimitOptions{}) {
+						if data.RateLimit.RPS <= 0 {
+							log.Fatalf("%s: rate_limit of %s needs rps > 0", in.Position(now.Pos()), now.Name.Name)
+						}
+						if data.RateLimit.Burst <= 0 {
+							data.RateLimit.Burst = int(math.Ceil(data.RateLimit.RPS))
+						}
+						if data.RateLimit.Key == "" {
+							data.RateLimit.Key = "ip"
+						}
+						switch {
+						case data.RateLimit.Key == "ip":
+						case data.RateLimit.Key == "principal":
+							if !data.Auth {
+								log.Fatalf("%s: rate_limit key principal of %s needs auth", in.Position(now.Pos()), now.Name.Name)
+							}
+						case strings.HasPrefix(data.RateLimit.Key, "header:") && len(data.RateLimit.Key) > len("header:"):
+						default:
+							log.Fatalf("%s: unknown rate_limit key %q for %s", in.Position(now.Pos()), data.RateLimit.Key, now.Name.Name)
+						}
 					}
 					strValidName := ""
 					inputStruct := now.Type.Params.List[1]
 					if validStruct, ok := inputStruct.Type.(*ast.Ident); ok {
 						strValidName = validStruct.Name
 					}
+					if _, ok := mapStrMethod[typeName(now.Recv.List[0].Type)]; !ok {
+						typeOrder = append(typeOrder, typeName(now.Recv.List[0].Type))
+					}
 					mapStrMethod[typeName(now.Recv.List[0].Type)] = append(mapStrMethod[typeName(now.Recv.List[0].Type)], genMethod{
 						Name:      now.Name.Name,
+						Recv:      typeName(now.Recv.List[0].Type),
 						Node:      now,
 						ValidName: strValidName,
 						Options:   data,
@@ -359,11 +2679,20 @@ func main() {
 		structFields := []field{}
 		for _, curField := range node.Fields.List {
 			f := field{}
-			tagSlice := strings.Split(strings.TrimPrefix(strings.Trim(curField.Tag.Value, `"`+"`"), `apivalidator:"`), ",")
+			structTag := ""
+			if curField.Tag != nil {
+				structTag, _ = strconv.Unquote(curField.Tag.Value)
+			}
+			tagSlice := strings.Split(reflect.StructTag(structTag).Get("apivalidator"), ",")
 			fieldTags := []tag{}
 			for _, curTag := range tagSlice {
 				if strings.HasPrefix(curTag, "paramname") {
 					f.ParamName, _ = strings.CutPrefix(curTag, "paramname=")
+				} else if strings.HasPrefix(curTag, "in=") {
+					f.In, _ = strings.CutPrefix(curTag, "in=")
+					if !paramSources[f.In] {
+						log.Fatalf("%s: unknown in=%s of %s.%s", in.Position(curField.Pos()), f.In, structName, curField.Names[0].Name)
+					}
 				} else {
 					t := tag{}
 					switch {
@@ -382,6 +2711,15 @@ func main() {
 					case strings.HasPrefix(curTag, "max="):
 						t.Name = "max"
 						t.Value, _ = strings.CutPrefix(curTag, "max=")
+					case strings.HasPrefix(curTag, "max_size="):
+						t.Name = "max_size"
+						t.Value, _ = strings.CutPrefix(curTag, "max_size=")
+					case strings.HasPrefix(curTag, "max_count="):
+						t.Name = "max_count"
+						t.Value, _ = strings.CutPrefix(curTag, "max_count=")
+					case strings.HasPrefix(curTag, "types="):
+						t.Name = "types"
+						t.Value, _ = strings.CutPrefix(curTag, "types=")
 					}
 					if t.Name != "" {
 						fieldTags = append(fieldTags, t)
@@ -390,51 +2728,210 @@ func main() {
 			}
 			f.FieldName = curField.Names[0].Name
 			f.Tags = fieldTags
-			f.IsInt = curField.Type.(*ast.Ident).Name == "int"
+			switch typ := curField.Type.(type) {
+			case *ast.Ident:
+				f.IsInt = typ.Name == "int"
+				if typ.Name != "int" && typ.Name != "string" {
+					log.Fatalf("%s: %s.%s must be string, int or file", in.Position(curField.Pos()), structName, f.FieldName)
+				}
+			case *ast.StarExpr:
+				f.File = isFileHeader(typ)
+			case *ast.ArrayType:
+				f.File = typ.Len == nil && isFileHeader(typ.Elt)
+				f.Multi = true
+			}
+			if _, ok := curField.Type.(*ast.Ident); !ok && !f.File {
+				log.Fatalf("%s: %s.%s must be string, int or file", in.Position(curField.Pos()), structName, f.FieldName)
+			}
+			for _, t := range f.Tags {
+				if fileTags[t.Name] != f.File && t.Name != "required" {
+					log.Fatalf("%s: %s of %s.%s is not for its type", in.Position(curField.Pos()), t.Name, structName, f.FieldName)
+				}
+			}
+			if f.File && f.In != "" && f.In != "body" {
+				log.Fatalf("%s: %s.%s is a file, it can only be in=body", in.Position(curField.Pos()), structName, f.FieldName)
+			}
 			structFields = append(structFields, f)
 		}
 		mapStructFields[structName] = structFields
 	}
+	for _, methods := range mapStrMethod {
+		for i, method := range methods {
+			methods[i].Params = mapStructFields[method.ValidName]
+			_, pathParams := patternParams(method.Options.URL)
+			for _, field := range methods[i].Params {
+				if field.In == "path" && !contains(pathParams, fieldParamName(field)) {
+					log.Fatalf("%s: %s.%s is in=path but %s has no {%s}", in.Position(method.Node.Pos()),
+						method.ValidName, field.FieldName, method.Options.URL, fieldParamName(field))
+				}
+			}
+		}
+	}
 	fmt.Printf("Structs reading done!\n\n")
 
 	fmt.Println("Generating started")
 	fmt.Fprintf(out, "\n// Result from wrappers\n")
-	fmt.Fprintf(out, "type resValue map[string]interface{}\n")
-	for structName, methodSlice := range mapStrMethod {
+	fmt.Fprintf(out, "type apigenResValue map[string]interface{}\n")
+	importList = addImport(importList, "context", "errors", "log/slog", "mime", "net/url", "runtime/debug", "strings", "time")
+	tplConfigSupport.Execute(out, tpl{})
+	importList = addImport(importList, "fmt", "sort", "strings", "sync", "sync/atomic")
+	tplMetricsSupport.Execute(out, tpl{})
+	importList = addImport(importList, "crypto/rand", "encoding/hex")
+	tplTracingSupport.Execute(out, tpl{})
+	importList = addImport(importList, "container/list", "crypto/sha256", "encoding/hex", "net")
+	tplRateLimitSupport.Execute(out, tpl{})
+	tplCORSSupport.Execute(out, tpl{})
+	for _, structName := range typeOrder {
+		if hasSignature(mapStrMethod[structName]) {
+			tplSignatureSupport.Execute(out, tpl{})
+			break
+		}
+	}
+	for _, fields := range mapStructFields {
+		if hasFiles(fields) {
+			importList = addImport(importList, "mime/multipart", "strconv", "strings")
+			tplFileSupport.Execute(out, tpl{})
+			break
+		}
+	}
+	for _, structName := range typeOrder {
+		if hasConcurrency(mapStrMethod[structName]) {
+			tplConcurrencySupport.Execute(out, tpl{})
+			break
+		}
+	}
+	if !*genMux {
+		importList = addImport(importList, "path", "strings")
+		tplRouterSupport.Execute(out, tpl{Value: fmt.Sprint(maxPathParams)})
+	}
+	for _, structName := range typeOrder {
+		methodSlice := mapStrMethod[structName]
 		fmt.Fprintf(out, "\n// ...\n// generated for type: %s\n// ...\n", structName)
+		methodSigns := []string{}
+		for _, method := range methodSlice {
+			sign := &bytes.Buffer{}
+			printer.Fprint(sign, in, method.Node.Type)
+			methodSigns = append(methodSigns, method.Name+strings.TrimPrefix(sign.String(), "func"))
+		}
+		tplServiceInterface.Execute(out, struct {
+			TypeName  string
+			Methods   []string
+			Signature bool
+		}{structName, methodSigns, hasSignature(methodSlice)})
+		if *genHandlerType {
+			tplHandlerType.Execute(out, tpl{TypeName: structName})
+		}
 		for _, method := range methodSlice {
 			fmt.Printf("\tgenerate method %s: \n", method.Name)
+			if len(method.Options.CORS.Origins) > 0 {
+				tplCORSVar.Execute(out, method)
+			}
+			tplChainVar.Execute(out, struct {
+				TypeName       string
+				MethodName     string
+				Service        string
+				Middleware     []string
+				MaxConcurrency int
+			}{handlerType(structName), method.Name, structName, method.Options.Middleware, method.Options.MaxConcurrency})
 			fmt.Fprintf(out, "\n// %#v\n", method.Options)
 			methodWrapOpen.Execute(out, tpl{
-				TypeName:   structName,
+				TypeName:   handlerType(structName),
 				MethodName: method.Name,
+				Value:      method.Options.URL,
+				Service:    structName,
 			})
 			// Генерация враппера (проверки и т.п.)
+			bodyLimit := ""
+			if method.Options.MaxBody > 0 {
+				bodyLimit = strconv.FormatInt(int64(method.Options.MaxBody), 10)
+			}
+			// CORS headers first, so browsers can read even the 413 of the body limit
+			tplCORS.Execute(out, method)
+			tplBodyLimit.Execute(out, tpl{Value: bodyLimit})
+			// failed credentials are throttled too, only principal keys need auth first
+			principalLimit := method.Options.RateLimit.Key == "principal"
+			if method.Options.RateLimit.RPS > 0 && !principalLimit {
+				tplRateLimit.Execute(out, method)
+			}
 			if method.Options.Auth {
-				tplAuth.Execute(out, tpl{})
+				tplAuth.Execute(out, tpl{Value: method.Options.AuthScheme})
+			}
+			if method.Options.Method != "" {
+				tplMethod.Execute(out, tpl{Value: methodExpr(method.Options.Method)})
+			}
+			if method.Options.RateLimit.RPS > 0 && principalLimit {
+				tplRateLimit.Execute(out, method)
+			}
+			if method.Options.Signature.Header != "" {
+				importList = addImport(importList, "bytes", "crypto/hmac", signatureAlgos[method.Options.Signature.Algo], "encoding/hex", "strings", "time")
+				tplSignature.Execute(out, method)
 			}
-			if method.Options.Method == http.MethodPost {
-				tplMethod.Execute(out, tpl{Value: "http.MethodPost"})
-			} else if method.Options.Method == http.MethodGet {
-				tplMethod.Execute(out, tpl{Value: "http.MethodGet"})
+			if method.Options.MaxConcurrency > 0 {
+				tplConcurrency.Execute(out, struct {
+					Method   genMethod
+					TypeName string
+					Timeout  string
+				}{method, handlerType(structName), durationExpr(time.Duration(method.Options.QueueWait))})
 			}
-			validGen(out, method.ValidName, mapStructFields[method.ValidName])
-			responseGen(out, method.Name, method.ValidName, mapStructFields[method.ValidName])
+			tplMiddleware.Execute(out, tpl{TypeName: handlerType(structName), MethodName: method.Name})
+			_, pathParams := patternParams(method.Options.URL)
+			validGen(out, method.ValidName, mapStructFields[method.ValidName], pathParams)
+			responseGen(out, method, mapStructFields[method.ValidName])
 			methodWrapClose.Execute(out, tpl{})
 		}
-		// to template
-		serveTplOpen.Execute(out, tpl{TypeName: structName})
-		fmt.Fprintf(out, "\tswitch r.URL.Path {\n")
+		methodNames := []string{}
 		for _, method := range methodSlice {
-			fmt.Fprintln(out, `	case "`+method.Options.URL+`":`)
-			tplServeHTTP.Execute(out, tpl{MethodName: method.Name})
+			methodNames = append(methodNames, method.Name)
+		}
+		tplChains.Execute(out, tpl{TypeName: handlerType(structName), Slice: methodNames})
+		// to template
+		tree, routes := buildRoutes(methodSlice, in)
+		if *genMux {
+			registerGen(out, structName, routes)
+		} else {
+			serveGen(out, handlerType(structName), tree, routes, nil)
 		}
-		fmt.Fprintf(out, "\tdefault:\n")
-		tplUnkMethod.Execute(out, tpl{})
-		fmt.Fprintf(out, "\t}\n")
-		serveTplClose.Execute(out, tpl{})
+		routesGen(out, handlerType(structName), routes, nil)
 		// end to template
 	}
+	if *genRouter {
+		allMethods := []genMethod{}
+		fields := map[string]string{}
+		fmt.Fprintf(out, "\n// Router mounts all API types of the file under their prefixes\ntype Router struct {\n")
+		for _, structName := range typeOrder {
+			allMethods = append(allMethods, mapStrMethod[structName]...)
+			fields[structName] = lowerFirst(structName)
+			fmt.Fprintf(out, "\t%s *%s\n", fields[structName], handlerType(structName))
+		}
+		fmt.Fprintf(out, "\tcfg HandlerConfig\n}\n")
+		tplNewRouter.Execute(out, struct {
+			Types   []string
+			Handler bool
+		}{typeOrder, *genHandlerType})
+		tree, routes := buildRoutes(allMethods, in)
+		serveGen(out, "Router", tree, routes, fields)
+		routesGen(out, "Router", routes, fields)
+	}
+
+	src := &bytes.Buffer{}
+	fmt.Fprintln(src, `package `+node.Name.Name)
+	fmt.Fprintln(src)
+	fmt.Fprintln(src, "import (")
+	for _, item := range importList {
+		fmt.Fprintln(src, `	"`+item+`"`)
+	}
+	fmt.Fprintln(src, ")")
+	out.WriteTo(src)
+	// templates don't keep fields and imports aligned, gofmt does
+	formatted, err := format.Source(src.Bytes())
+	if err != nil {
+		// the file is written anyway, the compiler shows where it's broken
+		log.Printf("cant format %s: %s", flag.Arg(1), err)
+		formatted = src.Bytes()
+	}
+	if err := os.WriteFile(flag.Arg(1), formatted, 0644); err != nil {
+		log.Fatal(err)
+	}
 
 	fmt.Printf("All done!\n")
 	fmt.Printf("by @kayot123")
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// codegen is the generator built once for all tests, log.Fatalf can't be checked in-process
+var codegen string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "codegen")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	codegen = filepath.Join(dir, "codegen")
+	if out, err := exec.Command("go", "build", "-o", codegen, ".").CombinedOutput(); err != nil {
+		fmt.Fprintf(os.Stderr, "cant build the generator: %s\n%s", err, out)
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// generate runs the generator on src in dir, its output comes back with the error
+func generate(t *testing.T, dir, src string, flags ...string) (string, error) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, "api.go"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(codegen, append(flags, "api.go", "api_handlers.go")...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	return string(out), err
+}
+
+// testModule generates api_handlers.go for testdata/name in a module of its own
+// and runs go vet and the tests of the case there
+func testModule(t *testing.T, name, goVersion string, flags ...string) {
+	t.Helper()
+	dir := t.TempDir()
+	files, err := filepath.Glob(filepath.Join("testdata", name, "*.go"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no files of %s: %v", name, err)
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, filepath.Base(file)), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mod := fmt.Sprintf("module apigentest\n\ngo %s\n", goVersion)
+	if err := os.WriteFile(filepath.Join(dir, "go.mod"), []byte(mod), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(codegen, append(flags, "api.go", "api_handlers.go")...)
+	cmd.Dir = dir
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("generator: %s\n%s", err, out)
+	}
+	for _, args := range [][]string{{"vet", "."}, {"test", "-count=1", "."}} {
+		cmd := exec.Command("go", args...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "GOWORK=off", "GOFLAGS=")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("go %s: %s\n%s", args[0], err, out)
+		}
+	}
+}
+
+// apiSrc is a file with Api and OtherApi, methods go after it
+const apiSrc = `package main
+
+import "context"
+
+type Api struct{}
+
+type OtherApi struct{}
+
+type Params struct {
+	ID   string ` + "`apivalidator:\"required\"`" + `
+	Name string
+}
+
+type Result struct{}
+`
+
+// method is an annotated method of recv with the options
+func method(recv, name, options string) string {
+	return fmt.Sprintf("\n// apigen:api %s\nfunc (srv *%s) %s(ctx context.Context, in Params) (*Result, error) {\n\treturn &Result{}, nil\n}\n",
+		options, recv, name)
+}
+
+// position is where the method starts in src, as the generator reports it
+func position(src, recv, name string) string {
+	i := strings.Index(src, fmt.Sprintf("func (srv *%s) %s(", recv, name))
+	return fmt.Sprintf("api.go:%d:1", strings.Count(src[:i], "\n")+1)
+}
+
+func TestRouteConflicts(t *testing.T) {
+	cases := []struct {
+		name    string
+		flags   []string
+		methods [][3]string
+		want    string
+	}{
+		{"duplicate", nil, [][3]string{
+			{"Api", "Get", `{"url": "/items/{id}", "method": "GET"}`},
+			{"Api", "Show", `{"url": "/items/{id}", "method": "GET"}`},
+		}, `Api.Show "GET" /items/{id} duplicates Api.Get`},
+		{"duplicate any method", nil, [][3]string{
+			{"Api", "Get", `{"url": "/items"}`},
+			{"Api", "List", `{"url": "/items"}`},
+		}, `Api.List "" /items duplicates Api.Get`},
+		{"ambiguous", nil, [][3]string{
+			{"Api", "Get", `{"url": "/items/{id}", "method": "GET"}`},
+			{"Api", "Rename", `{"url": "/items/{name}", "method": "POST"}`},
+		}, `Api.Rename /items/{name} is ambiguous with Api.Get /items/{id}`},
+		{"router", []string{"-router"}, [][3]string{
+			{"Api", "Get", `{"url": "/items/{id}", "method": "GET"}`},
+			{"OtherApi", "Get", `{"url": "/items/{id}", "method": "GET"}`},
+		}, `OtherApi.Get "GET" /items/{id} duplicates Api.Get`},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			src := apiSrc
+			for _, m := range c.methods {
+				src += method(m[0], m[1], m[2])
+			}
+			out, err := generate(t, t.TempDir(), src, c.flags...)
+			if err == nil {
+				t.Fatalf("generated with a conflict:\n%s", out)
+			}
+			first := position(src, c.methods[0][0], c.methods[0][1])
+			second := position(src, c.methods[1][0], c.methods[1][1])
+			if !strings.Contains(out, c.want) || !strings.Contains(out, second+": ") || !strings.Contains(out, "at "+first) {
+				t.Errorf("want %q between %s and %s, got:\n%s", c.want, second, first, out)
+			}
+		})
+	}
+}
+
+func TestRouteNoConflicts(t *testing.T) {
+	src := apiSrc +
+		method("Api", "Get", `{"url": "/items/{id}", "method": "GET"}`) +
+		method("Api", "Update", `{"url": "/items/{id}", "method": "POST"}`) +
+		method("Api", "New", `{"url": "/items/new", "method": "GET"}`) +
+		// types are served on their own without -router
+		method("OtherApi", "Get", `{"url": "/items/{name}", "method": "GET"}`)
+	if out, err := generate(t, t.TempDir(), src); err != nil {
+		t.Errorf("%s:\n%s", err, out)
+	}
+}
+
+func TestServiceOptions(t *testing.T) {
+	testModule(t, "service", "1.21")
+}
+
+func TestServiceURL(t *testing.T) {
+	src := strings.Replace(apiSrc, "type Api struct{}", "// apigen:service {\"url\": \"/api\"}\ntype Api struct{}", 1) +
+		method("Api", "Get", `{"url": "/items/{id}", "method": "GET"}`)
+	out, err := generate(t, t.TempDir(), src)
+	if err == nil || !strings.Contains(out, "api.go:6:6: apigen:service of Api has url, use prefix") {
+		t.Errorf("%v:\n%s", err, out)
+	}
+}
+
+func TestRouterFlag(t *testing.T) {
+	testModule(t, "router", "1.21", "-router")
+}
+
+func TestHandlerTypeFlag(t *testing.T) {
+	testModule(t, "handlertype", "1.21", "-handler-type")
+}
+
+func TestMuxFlag(t *testing.T) {
+	testModule(t, "mux", "1.22", "-mux")
+}
+
+func TestMuxRouterFlags(t *testing.T) {
+	src := apiSrc + method("Api", "Get", `{"url": "/items/{id}", "method": "GET"}`)
+	out, err := generate(t, t.TempDir(), src, "-mux", "-router")
+	if err == nil || !strings.Contains(out, "-mux and -router can't be used together") {
+		t.Errorf("%v:\n%s", err, out)
+	}
+}
+
+func TestBadOptions(t *testing.T) {
+	cases := []struct {
+		options string
+		want    string
+	}{
+		{`{"url": "/items", "rate_limit": {"rps": "fast"}}`, "cant UNPACK apigen:api of Get"},
+		{`{"url": "/items", "timeout": "soon"}`, "cant UNPACK apigen:api of Get"},
+		{`{"url": "/items", "max_body": "a lot"}`, "cant UNPACK apigen:api of Get"},
+		{`{"url": "/items", "rate_limit": {"rps": -1}}`, "rate_limit of Get needs rps > 0"},
+		{`{"url": "/items", "rate_limit": {"rps": 1, "key": "principal"}}`, "rate_limit key principal of Get needs auth"},
+		{`{"url": "/items", "rate_limit": {"rps": 1, "key": "cookie"}}`, `unknown rate_limit key "cookie" for Get`},
+		{`{"url": "/items", "auth": true, "auth_scheme": "jwt"}`, `unknown auth scheme "jwt" for Get`},
+		{`{"url": "/items", "signature": {"header": "X-Signature", "algo": "md5"}}`, `unknown signature algo "md5" for Get`},
+		{`{"url": "/items", "cors": {"methods": ["GET"]}}`, "cors of Get has no origins"},
+		{`{"url": "/items", "cors": {"origins": ["*"], "credentials": true}}`, "cors of Get allows credentials from any origin"},
+	}
+	for _, c := range cases {
+		src := apiSrc + method("Api", "Get", c.options)
+		out, err := generate(t, t.TempDir(), src)
+		if err == nil || !strings.Contains(out, position(src, "Api", "Get")+": "+c.want) {
+			t.Errorf("%s: %v\n%s", c.options, err, out)
+		}
+	}
+}
+
+func TestBadParams(t *testing.T) {
+	cases := []struct {
+		tag  string
+		url  string
+		want string
+	}{
+		{`apivalidator:"in=form"`, "/items", "unknown in=form of Params.Name"},
+		{`apivalidator:"in=path"`, "/items/{id}", "Params.Name is in=path but /items/{id} has no {name}"},
+	}
+	for _, c := range cases {
+		src := strings.Replace(apiSrc, "\tName string\n", "\tName string `"+c.tag+"`\n", 1) +
+			method("Api", "Get", `{"url": "`+c.url+`", "method": "GET"}`)
+		out, err := generate(t, t.TempDir(), src)
+		if err == nil || !strings.Contains(out, "api.go:") || !strings.Contains(out, c.want) {
+			t.Errorf("%s: %v\n%s", c.tag, err, out)
+		}
+	}
+}
+
+func TestParamInFlag(t *testing.T) {
+	src := apiSrc + method("Api", "Get", `{"url": "/items", "method": "GET"}`)
+	dir := t.TempDir()
+	if out, err := generate(t, dir, src, "-param-in", "header"); err != nil {
+		t.Fatalf("%s:\n%s", err, out)
+	}
+	generated, err := os.ReadFile(filepath.Join(dir, "api_handlers.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(generated), `r.Header.Get("id")`) {
+		t.Error("params without in= are not read from headers")
+	}
+	if out, err := generate(t, dir, src, "-param-in", "path"); err == nil || !strings.Contains(out, `unknown param source "path"`) {
+		t.Errorf("%v:\n%s", err, out)
+	}
+}
+
+func TestBadFileParams(t *testing.T) {
+	cases := []struct {
+		tag  string
+		want string
+	}{
+		{`apivalidator:"max_size=big"`, "bad max_size=big of Photo"},
+		{`apivalidator:"max_count=-1"`, "bad max_count=-1 of Photo"},
+		{`apivalidator:"in=query"`, "Params.Photo is a file, it can only be in=body"},
+	}
+	for _, c := range cases {
+		src := strings.Replace(apiSrc, `import "context"`, "import (\n\t\"context\"\n\t\"mime/multipart\"\n)", 1)
+		src = strings.Replace(src, "\tName string\n", "\tPhoto []*multipart.FileHeader `"+c.tag+"`\n", 1) +
+			method("Api", "Upload", `{"url": "/photos", "method": "POST"}`)
+		out, err := generate(t, t.TempDir(), src)
+		if err == nil || !strings.Contains(out, c.want) {
+			t.Errorf("%s: %v\n%s", c.tag, err, out)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import "context"
+
+type ApiError struct {
+	HTTPStatus int
+	Err        error
+}
+
+func (ae ApiError) Error() string {
+	return ae.Err.Error()
+}
+
+type Params struct {
+	ID string `apivalidator:"required"`
+}
+
+type Result struct {
+	ID string `json:"id"`
+}
+
+// Users stays a plain type, UsersHandler serves it
+type Users struct{}
+
+// apigen:api {"url": "/users/{id}", "method": "GET"}
+func (srv *Users) Get(ctx context.Context, in Params) (*Result, error) {
+	return &Result{ID: in.ID}, nil
+}
+
+// apigen:api {"url": "/users/{id}", "method": "DELETE", "auth": true}
+func (srv *Users) Delete(ctx context.Context, in Params) (*Result, error) {
+	return &Result{ID: in.ID}, nil
+}
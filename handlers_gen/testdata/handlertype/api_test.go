@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandlerType(t *testing.T) {
+	var svc interface{} = &Users{}
+	if _, ok := svc.(http.Handler); ok {
+		t.Error("Users got ServeHTTP with -handler-type")
+	}
+	h := NewUsersHandler(&Users{}, WithAuthVerifier(func(r *http.Request, cred AuthCredential) bool {
+		return cred.Token == "secret"
+	}))
+	cases := []struct {
+		method string
+		auth   string
+		status int
+		body   string
+	}{
+		{"GET", "", 200, `{"id":"7"}`},
+		{"DELETE", "secret", 200, `{"id":"7"}`},
+		// options of the handler, not DefaultHandlerConfig
+		{"DELETE", "100500", 403, "unauthorized"},
+		{"PUT", "", 406, "bad method"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, "/users/7", nil)
+		r.Header.Set("X-Auth", c.auth)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != c.status || !strings.Contains(w.Body.String(), c.body) {
+			t.Errorf("%s %q: %d %s", c.method, c.auth, w.Code, w.Body.String())
+		}
+	}
+}
+
+// missingUsers is a mock of UsersService
+type missingUsers struct{}
+
+func (missingUsers) Get(ctx context.Context, in Params) (*Result, error) {
+	return nil, ApiError{http.StatusNotFound, errors.New("user not exist")}
+}
+
+func (missingUsers) Delete(ctx context.Context, in Params) (*Result, error) {
+	return nil, errors.New("not implemented")
+}
+
+// countingUsers decorates another UsersService
+type countingUsers struct {
+	UsersService
+	calls int
+}
+
+func (cu *countingUsers) Get(ctx context.Context, in Params) (*Result, error) {
+	cu.calls++
+	return cu.UsersService.Get(ctx, in)
+}
+
+func TestServiceInterface(t *testing.T) {
+	var _ UsersService = &Users{}
+	get := func(svc UsersService) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		NewUsersHandler(svc).ServeHTTP(w, httptest.NewRequest("GET", "/users/7", nil))
+		return w
+	}
+	if w := get(missingUsers{}); w.Code != 404 || !strings.Contains(w.Body.String(), "user not exist") {
+		t.Errorf("mock: %d %s", w.Code, w.Body.String())
+	}
+	counting := &countingUsers{UsersService: &Users{}}
+	if w := get(counting); w.Code != 200 || counting.calls != 1 {
+		t.Errorf("decorator: %d %s, %d calls", w.Code, w.Body.String(), counting.calls)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	mux := http.NewServeMux()
+	RegisterUsers(mux, &Users{})
+	mux.HandleFunc("GET /health", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	cases := []struct {
+		method string
+		path   string
+		auth   string
+		status int
+		body   string
+	}{
+		{"GET", "/users/7", "", 200, `{"id":"7"}`},
+		{"DELETE", "/users/7", "100500", 200, `{"id":"7"}`},
+		{"DELETE", "/users/7", "", 403, "unauthorized"},
+		// ServeMux answers methods without a pattern
+		{"PUT", "/users/7", "", 405, ""},
+		{"GET", "/files/a/b.txt", "", 200, `{"id":"a/b.txt"}`},
+		{"GET", "/health", "", 200, "ok"},
+		{"GET", "/unknown", "", 404, ""},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, c.path, nil)
+		r.Header.Set("X-Auth", c.auth)
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		if w.Code != c.status || !strings.Contains(w.Body.String(), c.body) {
+			t.Errorf("%s %s: %d %s", c.method, c.path, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRegisterNoServeHTTP(t *testing.T) {
+	var svc interface{} = &Users{}
+	if _, ok := svc.(http.Handler); ok {
+		t.Error("Users got ServeHTTP with -mux")
+	}
+}
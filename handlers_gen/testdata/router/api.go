@@ -0,0 +1,42 @@
+package main
+
+import "context"
+
+type ApiError struct {
+	HTTPStatus int
+	Err        error
+}
+
+func (ae ApiError) Error() string {
+	return ae.Err.Error()
+}
+
+type Params struct {
+	ID string `apivalidator:"required"`
+}
+
+type Result struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// apigen:service {"prefix": "/users"}
+type Users struct{}
+
+// apigen:api {"url": "/{id}", "method": "GET"}
+func (srv *Users) Get(ctx context.Context, in Params) (*Result, error) {
+	return &Result{Type: "user", ID: in.ID}, nil
+}
+
+// apigen:api {"url": "/{id}", "method": "POST", "auth": true}
+func (srv *Users) Update(ctx context.Context, in Params) (*Result, error) {
+	return &Result{Type: "user", ID: in.ID}, nil
+}
+
+// apigen:service {"prefix": "/orders"}
+type Orders struct{}
+
+// apigen:api {"url": "/{id}", "method": "GET"}
+func (srv *Orders) Get(ctx context.Context, in Params) (*Result, error) {
+	return &Result{Type: "order", ID: in.ID}, nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRouter(t *testing.T) {
+	notFound := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	router := NewRouter(&Users{}, &Orders{}, WithNotFound(notFound))
+	cases := []struct {
+		method string
+		path   string
+		auth   string
+		status int
+		body   string
+	}{
+		{"GET", "/users/1", "", 200, `{"type":"user","id":"1"}`},
+		{"POST", "/users/1", "100500", 200, `{"type":"user","id":"1"}`},
+		{"POST", "/users/1", "", 403, "unauthorized"},
+		{"GET", "/orders/2", "", 200, `{"type":"order","id":"2"}`},
+		{"POST", "/orders/2", "", 406, "bad method"},
+		{"GET", "/orders/2/", "", 301, ""},
+		{"GET", "/items/3", "", http.StatusTeapot, ""},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, c.path, nil)
+		r.Header.Set("X-Auth", c.auth)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != c.status || !strings.Contains(w.Body.String(), c.body) {
+			t.Errorf("%s %s: %d %s", c.method, c.path, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRouterRoutes(t *testing.T) {
+	want := map[string]string{
+		"GET /users/{id}":  "Users.Get",
+		"POST /users/{id}": "Users.Update",
+		"GET /orders/{id}": "Orders.Get",
+	}
+	routes := NewRouter(&Users{}, &Orders{}).Routes()
+	for _, route := range routes {
+		if got := route.Service + "." + route.Name; want[route.Method+" "+route.Pattern] != got {
+			t.Errorf("unexpected route %s %s of %s", route.Method, route.Pattern, got)
+		}
+	}
+	if len(routes) != len(want) {
+		t.Errorf("%d routes, want %d", len(routes), len(want))
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import "context"
+
+type ApiError struct {
+	HTTPStatus int
+	Err        error
+}
+
+func (ae ApiError) Error() string {
+	return ae.Err.Error()
+}
+
+type Params struct {
+	Name string `apivalidator:"required"`
+}
+
+type Result struct {
+	Name string `json:"name"`
+}
+
+// Admin takes the prefix, auth and method of the service
+// apigen:service {"prefix": "/api/v1", "auth": true, "method": "POST"}
+type Admin struct{}
+
+// apigen:api {"url": "/users"}
+func (srv *Admin) Users(ctx context.Context, in Params) (*Result, error) {
+	return &Result{Name: in.Name}, nil
+}
+
+// apigen:api {"url": "/status", "auth": false, "method": "GET"}
+func (srv *Admin) Status(ctx context.Context, in Params) (*Result, error) {
+	return &Result{Name: in.Name}, nil
+}
+
+// apigen:service {"prefix": "/api/v2/"}
+type Public struct{}
+
+// apigen:api {"url": "/users", "method": "GET"}
+func (srv *Public) Users(ctx context.Context, in Params) (*Result, error) {
+	return &Result{Name: in.Name}, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestServiceDefaults(t *testing.T) {
+	cases := []struct {
+		name   string
+		h      http.Handler
+		method string
+		path   string
+		auth   string
+		status int
+		body   string
+	}{
+		{"prefix and auth", &Admin{}, "POST", "/api/v1/users?name=a", "100500", 200, `"name":"a"`},
+		{"auth of the service", &Admin{}, "POST", "/api/v1/users?name=a", "", 403, "unauthorized"},
+		{"method of the service", &Admin{}, "GET", "/api/v1/users?name=a", "100500", 406, "bad method"},
+		{"overridden", &Admin{}, "GET", "/api/v1/status?name=a", "", 200, `"name":"a"`},
+		{"no prefix", &Admin{}, "POST", "/users?name=a", "100500", 404, "unknown method"},
+		// a trailing slash of the prefix is dropped
+		{"other prefix", &Public{}, "GET", "/api/v2/users?name=b", "", 200, `"name":"b"`},
+		{"prefix of the other type", &Public{}, "GET", "/api/v1/users?name=b", "", 404, "unknown method"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest(c.method, c.path, nil)
+		r.Header.Set("X-Auth", c.auth)
+		w := httptest.NewRecorder()
+		c.h.ServeHTTP(w, r)
+		if w.Code != c.status || !strings.Contains(w.Body.String(), c.body) {
+			t.Errorf("%s: %d %s", c.name, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	withConfig(t, WithMetrics(metrics))
+	for _, path := range []string{
+		"/user/profile?login=rvasily",
+		"/user/profile?login=rvasily",
+		"/user/profile",
+		"/user/profile?login=nobody",
+		// unknown paths have no route label
+		"/user/unknown",
+	} {
+		serve(NewMyApi(), httptest.NewRequest("GET", path, nil))
+	}
+	w := serve(metrics, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("content type %q", ct)
+	}
+	labels := `route="/user/profile",method="Profile"`
+	want := []string{
+		"# TYPE apigen_requests_total counter",
+		`apigen_requests_total{` + labels + `,status="2xx"} 2`,
+		`apigen_requests_total{` + labels + `,status="4xx"} 2`,
+		"# TYPE apigen_request_duration_seconds histogram",
+		`apigen_request_duration_seconds_bucket{` + labels + `,le="+Inf"} 4`,
+		`apigen_request_duration_seconds_count{` + labels + `} 4`,
+		"# TYPE apigen_requests_in_flight gauge",
+		`apigen_requests_in_flight{` + labels + `} 0`,
+		"# TYPE apigen_requests_shed_total counter",
+	}
+	for _, line := range want {
+		if !strings.Contains(w.Body.String(), line+"\n") {
+			t.Errorf("no %s in\n%s", line, w.Body.String())
+		}
+	}
+	if strings.Contains(w.Body.String(), "unknown") || strings.Contains(w.Body.String(), "5xx") {
+		t.Errorf("unexpected series in\n%s", w.Body.String())
+	}
+}
+
+func TestMetricsOff(t *testing.T) {
+	withConfig(t, WithMetrics(nil))
+	if w := serve(NewMyApi(), httptest.NewRequest("GET", "/user/profile?login=rvasily", nil)); w.Code != 200 {
+		t.Errorf("%d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestMetricsHandler(t *testing.T) {
+	withConfig(t)
+	serve(NewShopApi(), httptest.NewRequest("GET", "/shop/items/7", nil))
+	w := serve(MetricsHandler(), httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.Contains(w.Body.String(), `apigen_requests_total{route="/shop/items/{id}",method="Item",status="2xx"}`) {
+		t.Errorf("DefaultMetrics are not served:\n%s", w.Body.String())
+	}
+}
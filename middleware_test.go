@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// tracing is a middleware adding its name to trace on the way in
+func tracing(trace *[]string, name string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*trace = append(*trace, name)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestMiddlewareOrder(t *testing.T) {
+	trace := []string{}
+	withConfig(t,
+		WithMiddleware(tracing(&trace, "global")),
+		WithServiceMiddleware("AdminApi", tracing(&trace, "service")),
+		WithServiceMiddleware("ShopApi", tracing(&trace, "shop")),
+		WithNamedMiddleware("audit", tracing(&trace, "audit")),
+		WithNamedMiddleware("confirm", tracing(&trace, "confirm")),
+	)
+	cases := []struct {
+		method string
+		path   string
+		auth   string
+		status int
+		want   []string
+	}{
+		{"GET", "/admin/stats", "100500", 200, []string{"global", "service", "audit"}},
+		// the method list replaces the one of the service
+		{"POST", "/admin/reindex", "100500", 200, []string{"global", "service", "confirm"}},
+		// middlewares run after auth
+		{"GET", "/admin/stats", "", 403, []string{}},
+		{"POST", "/admin/stats", "100500", 406, []string{}},
+	}
+	for _, c := range cases {
+		trace = trace[:0]
+		r := httptest.NewRequest(c.method, c.path, nil)
+		r.Header.Set("X-Auth", c.auth)
+		if w := serve(NewAdminApi(), r); w.Code != c.status || !reflect.DeepEqual(trace, c.want) {
+			t.Errorf("%s %s: %d %s, trace %v", c.method, c.path, w.Code, w.Body.String(), trace)
+		}
+	}
+}
+
+func TestMiddlewareSeesResponse(t *testing.T) {
+	withConfig(t, WithNamedMiddleware("audit", func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Audited", r.URL.Query().Get("period"))
+			next.ServeHTTP(w, r)
+		})
+	}))
+	r := httptest.NewRequest("GET", "/admin/stats?period=week", nil)
+	r.Header.Set("X-Auth", "100500")
+	w := serve(NewAdminApi(), r)
+	if w.Code != 200 || w.Header().Get("X-Audited") != "week" || !strings.Contains(w.Body.String(), `"period":"week"`) {
+		t.Errorf("%d %q %s", w.Code, w.Header().Get("X-Audited"), w.Body.String())
+	}
+}
+
+func TestMiddlewareUnknown(t *testing.T) {
+	// DefaultHandlerConfig builds chains on the first request
+	logs := &bytes.Buffer{}
+	withConfig(t, WithLogger(slog.New(slog.NewTextHandler(logs, nil))))
+	r := httptest.NewRequest("GET", "/admin/stats", nil)
+	r.Header.Set("X-Auth", "100500")
+	if w := serve(NewAdminApi(), r); w.Code != 500 || !strings.Contains(w.Body.String(), "audit") {
+		t.Errorf("%d %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(logs.String(), `msg="bad handler config" service=AdminApi`) {
+		t.Errorf("logged %q", logs.String())
+	}
+}
+
+func TestChainsOfManyValues(t *testing.T) {
+	withConfig(t)
+	for i := 0; i < 100; i++ {
+		if w := serve(NewShopApi(), httptest.NewRequest("GET", "/shop/items/"+strconv.Itoa(i), nil)); w.Code != 200 {
+			t.Fatalf("%d %s", w.Code, w.Body.String())
+		}
+	}
+	// one chain per method, not per API value
+	if n := len(DefaultHandlerConfig.chains.states); n != 1 {
+		t.Errorf("%d chains cached", n)
+	}
+}
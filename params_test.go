@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParamSources(t *testing.T) {
+	withConfig(t)
+	cases := []struct {
+		name    string
+		query   string
+		body    string
+		session string
+		version string
+		status  int
+		want    string
+	}{
+		{"all", "?coupon=SALE", "item=42", "s1", "2.0", 200,
+			`{"cart":"7","item":"42","coupon":"SALE","session":"s1","version":"2.0"}`},
+		// pinned sources don't look anywhere else
+		{"item in query", "?item=42", "", "s1", "2.0", 400, "item must me not empty"},
+		{"coupon in body", "", "item=42&coupon=SALE", "s1", "2.0", 200, `"coupon":""`},
+		{"id in body", "", "item=42&id=8", "s1", "2.0", 200, `"cart":"7"`},
+		{"no cookie", "?session=s1", "item=42", "", "2.0", 400, "session must me not empty"},
+		{"no header", "?X-Client-Version=2.0", "item=42", "s1", "", 400, `version len must be \u003e= 1`},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("POST", "/shop/carts/7/items"+c.query, strings.NewReader(c.body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if c.session != "" {
+			r.AddCookie(&http.Cookie{Name: "session", Value: c.session})
+		}
+		r.Header.Set("X-Client-Version", c.version)
+		w := serve(NewShopApi(), r)
+		if w.Code != c.status || !strings.Contains(w.Body.String(), c.want) {
+			t.Errorf("%s: %d %s", c.name, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestRouteParamSources(t *testing.T) {
+	for _, route := range NewShopApi().Routes() {
+		if route.Name != "AddToCart" {
+			continue
+		}
+		want := []RouteParam{
+			{Name: "id", In: "path"},
+			{Name: "item", In: "body"},
+			{Name: "coupon", In: "query"},
+			{Name: "session", In: "cookie"},
+			{Name: "X-Client-Version", In: "header"},
+		}
+		if !reflect.DeepEqual(route.Params, want) {
+			t.Errorf("%+v", route.Params)
+		}
+		return
+	}
+	t.Error("no route of ShopApi.AddToCart")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	withConfig(t)
+	order := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", "/shop/orders", strings.NewReader("item=1&count=1"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.RemoteAddr = "198.51.100.1:1234"
+		return serve(NewShopApi(), r)
+	}
+	// burst of 2, then 1 rps
+	for i := 0; i < 2; i++ {
+		if w := order(); w.Code != 200 {
+			t.Fatalf("order %d: %d %s", i, w.Code, w.Body.String())
+		}
+	}
+	w := order()
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Errorf("over the limit: %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
+
+// keyStore allows everything and keeps the keys it was asked about
+type keyStore struct {
+	keys []string
+}
+
+func (store *keyStore) Allow(key string, rps float64, burst int, now time.Time) (bool, time.Duration) {
+	store.keys = append(store.keys, key)
+	return true, 0
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	store := &keyStore{}
+	withConfig(t, audited(WithRateLimitStore(store))...)
+	search := httptest.NewRequest("GET", "/shop/search?q=shoes", nil)
+	search.RemoteAddr = "198.51.100.2:1234"
+	search.Header.Set("X-Api-Key", "key-of-the-client")
+	anonymous := httptest.NewRequest("GET", "/shop/search?q=shoes", nil)
+	anonymous.RemoteAddr = "198.51.100.2:1234"
+	report := httptest.NewRequest("GET", "/admin/report", nil)
+	report.Header.Set("X-Auth", "100500")
+	serve(NewShopApi(), search)
+	serve(NewShopApi(), anonymous)
+	serve(NewAdminApi(), report)
+	// secrets don't get to stores, shared ones may be read by others
+	want := []string{
+		"ShopApi.Search:" + apigenSecretKey("key-of-the-client"),
+		"ShopApi.Search:198.51.100.2",
+		"AdminApi.Report:" + apigenSecretKey("100500"),
+	}
+	if strings.Join(store.keys, " ") != strings.Join(want, " ") {
+		t.Errorf("keys %q, want %q", store.keys, want)
+	}
+}
+
+func TestRateLimitPrincipal(t *testing.T) {
+	withConfig(t, audited()...)
+	report := func(token string) int {
+		r := httptest.NewRequest("GET", "/admin/report", nil)
+		r.Header.Set("X-Auth", token)
+		return serve(NewAdminApi(), r).Code
+	}
+	if code := report("100500"); code != 200 {
+		t.Fatalf("first report: %d", code)
+	}
+	if code := report("100500"); code != http.StatusTooManyRequests {
+		t.Errorf("second report: %d", code)
+	}
+	// failed credentials don't take tokens of principals
+	if code := report("123"); code != http.StatusForbidden {
+		t.Errorf("bad token: %d", code)
+	}
+}
+
+func TestRateLimitOff(t *testing.T) {
+	withConfig(t, WithRateLimitStore(nil))
+	for i := 0; i < 5; i++ {
+		r := httptest.NewRequest("GET", "/shop/search?q=shoes", nil)
+		if w := serve(NewShopApi(), r); w.Code != 200 {
+			t.Fatalf("search %d: %d %s", i, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestTokenBucket(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	now := time.Now()
+	steps := []struct {
+		after      time.Duration
+		ok         bool
+		retryAfter time.Duration
+	}{
+		{0, true, 0},
+		{0, true, 0},
+		{0, false, 500 * time.Millisecond},
+		{250 * time.Millisecond, false, 250 * time.Millisecond},
+		{500 * time.Millisecond, true, 0},
+		{10 * time.Second, true, 0}, // refilled up to burst only
+		{10 * time.Second, true, 0},
+		{10 * time.Second, false, 500 * time.Millisecond},
+	}
+	for i, step := range steps {
+		ok, retryAfter := store.Allow("client", 2, 2, now.Add(step.after))
+		if ok != step.ok || retryAfter != step.retryAfter {
+			t.Errorf("step %d: %v %v, want %v %v", i, ok, retryAfter, step.ok, step.retryAfter)
+		}
+	}
+}
+
+func TestTokenBucketEviction(t *testing.T) {
+	store := NewMemoryRateLimitStoreSize(64)
+	now := time.Now()
+	for i := 0; i < 100000; i++ {
+		store.Allow(strconv.Itoa(i), 1, 1, now)
+	}
+	if n := store.Len(); n > 64+apigenRateLimitShards {
+		t.Errorf("%d buckets kept, want about 64", n)
+	}
+	// recently used keys stay
+	key := strconv.Itoa(99999)
+	if ok, _ := store.Allow(key, 1, 1, now); ok {
+		t.Errorf("bucket of %s was dropped", key)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// audited registers "audit" of AdminApi as a no-op
+func audited(opts ...HandlerOption) []HandlerOption {
+	return append([]HandlerOption{WithNamedMiddleware("audit", func(next http.Handler) http.Handler { return next })}, opts...)
+}
+
+func crash() *http.Request {
+	r := httptest.NewRequest("POST", "/admin/crash", nil)
+	r.Header.Set("X-Auth", "100500")
+	return r
+}
+
+func TestRecovery(t *testing.T) {
+	logs := &bytes.Buffer{}
+	withConfig(t, audited(WithLogger(slog.New(slog.NewTextHandler(logs, nil))))...)
+	w := serve(NewAdminApi(), crash())
+	if w.Code != 500 || !strings.HasPrefix(w.Body.String(), `{"error":"internal error"`) {
+		t.Errorf("%d %s", w.Code, w.Body.String())
+	}
+	if !strings.Contains(logs.String(), `msg="panic in handler" method=Crash`) || !strings.Contains(logs.String(), "recovery_test.go") {
+		t.Errorf("no panic with the stack in logs: %s", logs.String())
+	}
+}
+
+func TestRecoveryMiddleware(t *testing.T) {
+	withConfig(t, WithNamedMiddleware("audit", func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("audit is down")
+		})
+	}), WithLogger(slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))))
+	r := httptest.NewRequest("GET", "/admin/stats", nil)
+	r.Header.Set("X-Auth", "100500")
+	if w := serve(NewAdminApi(), r); w.Code != 500 {
+		t.Errorf("%d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestWithoutRecovery(t *testing.T) {
+	withConfig(t, audited(WithoutRecovery())...)
+	defer func() {
+		if recover() == nil {
+			t.Error("panic was recovered")
+		}
+	}()
+	serve(NewAdminApi(), crash())
+}
+
+func TestRecoveryAbortHandler(t *testing.T) {
+	withConfig(t, WithNamedMiddleware("audit", func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic(http.ErrAbortHandler)
+		})
+	}))
+	defer func() {
+		if rec := recover(); rec != http.ErrAbortHandler {
+			t.Errorf("recovered %v", rec)
+		}
+	}()
+	r := httptest.NewRequest("GET", "/admin/stats", nil)
+	r.Header.Set("X-Auth", "100500")
+	serve(NewAdminApi(), r)
+}
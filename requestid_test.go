@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var generatedID = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+func TestRequestID(t *testing.T) {
+	logs := &bytes.Buffer{}
+	withConfig(t, WithLogger(slog.New(slog.NewTextHandler(logs, nil))))
+	cases := []struct {
+		name   string
+		path   string
+		id     string
+		reused bool
+	}{
+		{"reused", "/user/profile", "client-id-1", true},
+		{"new", "/user/profile", "", false},
+		{"not printable", "/user/profile", "bad id", false},
+		{"too long", "/user/profile", strings.Repeat("a", 129), false},
+		// IDs are given before routing
+		{"unknown path", "/user/unknown", "client-id-2", true},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", c.path, nil)
+		r.Header.Set("X-Request-ID", c.id)
+		w := serve(NewMyApi(), r)
+		id := w.Header().Get("X-Request-ID")
+		if c.reused && id != c.id || !c.reused && !generatedID.MatchString(id) {
+			t.Errorf("%s: id %q", c.name, id)
+		}
+		if !strings.Contains(w.Body.String(), `"request_id":"`+id+`"`) {
+			t.Errorf("%s: no id in %s", c.name, w.Body.String())
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/user/profile?login=bad_user", nil)
+	r.Header.Set("X-Request-ID", "client-id-3")
+	serve(NewMyApi(), r)
+	if !strings.Contains(logs.String(), "request_id=client-id-3") {
+		t.Errorf("no id in logs: %s", logs.String())
+	}
+}
+
+func TestRequestIDHeader(t *testing.T) {
+	withConfig(t, WithRequestIDHeader("X-Trace-ID"))
+	r := httptest.NewRequest("GET", "/user/profile", nil)
+	r.Header.Set("X-Trace-ID", "trace-1")
+	r.Header.Set("X-Request-ID", "request-1")
+	w := serve(NewMyApi(), r)
+	if w.Header().Get("X-Trace-ID") != "trace-1" || w.Header().Get("X-Request-ID") != "" {
+		t.Errorf("%v", w.Header())
+	}
+}
+
+func TestRequestIDOff(t *testing.T) {
+	withConfig(t, WithRequestIDHeader(""))
+	r := httptest.NewRequest("GET", "/user/profile", nil)
+	r.Header.Set("X-Request-ID", "client-id")
+	w := serve(NewMyApi(), r)
+	if w.Header().Get("X-Request-ID") != "" || w.Body.String() != `{"error":"login must me not empty"}` {
+		t.Errorf("%v %s", w.Header(), w.Body.String())
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRoutes(t *testing.T) {
+	routes := NewMyApi().Routes()
+	for i := range routes {
+		if routes[i].Handler == nil {
+			t.Errorf("no handler of %s", routes[i].Name)
+		}
+		routes[i].Handler = nil
+	}
+	want := []Route{
+		{
+			Pattern: "/user/profile", Service: "MyApi", Name: "Profile", ParamStruct: "ProfileParams",
+			Params: []RouteParam{{Name: "login"}},
+		},
+		{
+			Method: "POST", Pattern: "/user/create", Service: "MyApi", Name: "Create",
+			Auth: true, AuthScheme: "header", ParamStruct: "CreateParams",
+			Params: []RouteParam{{Name: "login"}, {Name: "full_name"}, {Name: "status"}, {Name: "age"}},
+		},
+	}
+	if !reflect.DeepEqual(routes, want) {
+		t.Errorf("got %+v\nwant %+v", routes, want)
+	}
+}
+
+func TestRouteHandler(t *testing.T) {
+	withConfig(t)
+	for _, route := range NewShopApi().Routes() {
+		if route.Name != "Item" {
+			continue
+		}
+		if route.Method != "GET" || route.Pattern != "/shop/items/{id}" || !reflect.DeepEqual(route.Params, []RouteParam{{Name: "id", In: "path"}}) {
+			t.Errorf("%+v", route)
+		}
+		// other routers pass path values, the url doesn't matter
+		w := httptest.NewRecorder()
+		route.Handler(w, WithPathParams(httptest.NewRequest("GET", "/anything", nil), map[string]string{"id": "5"}))
+		if w.Code != 200 || w.Body.String() != `{"error":"","response":{"id":"5"}}` {
+			t.Errorf("%d %s", w.Code, w.Body.String())
+		}
+		return
+	}
+	t.Error("no route of ShopApi.Item")
+}
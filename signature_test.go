@@ -0,0 +1,74 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSignature(t *testing.T) {
+	withConfig(t)
+	body := "order=42&status=paid"
+	sign := func(secret string, timestamp int64) (string, string) {
+		ts := strconv.FormatInt(timestamp, 10)
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write([]byte(ts + "." + body))
+		return ts, hex.EncodeToString(mac.Sum(nil))
+	}
+	now := time.Now().Unix()
+	cases := []struct {
+		secret    string
+		timestamp int64
+		status    int
+	}{
+		{"shop-secret", now, 200},
+		{"other-secret", now, 401},
+		{"shop-secret", now - 3600, 401},
+		{"shop-secret", now + 3600, 401},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("POST", "/shop/hooks/payment", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		ts, signature := sign(c.secret, c.timestamp)
+		r.Header.Set("X-Timestamp", ts)
+		r.Header.Set("X-Signature", "sha256="+signature)
+		if w := serve(NewShopApi(), r); w.Code != c.status {
+			t.Errorf("%s at %d: %d %s", c.secret, c.timestamp, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestSignatureTampered(t *testing.T) {
+	withConfig(t)
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, []byte("shop-secret"))
+	mac.Write([]byte(ts + ".order=42&status=paid"))
+	signature := hex.EncodeToString(mac.Sum(nil))
+	cases := []struct {
+		name      string
+		body      string
+		timestamp string
+		signature string
+		status    int
+	}{
+		{"no prefix", "order=42&status=paid", ts, signature, 200},
+		{"other body", "order=43&status=paid", ts, signature, 401},
+		{"no signature", "order=42&status=paid", ts, "", 401},
+		{"no timestamp", "order=42&status=paid", "", signature, 401},
+		{"not hex", "order=42&status=paid", ts, "sha256=zz", 401},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("POST", "/shop/hooks/payment", strings.NewReader(c.body))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("X-Timestamp", c.timestamp)
+		r.Header.Set("X-Signature", c.signature)
+		if w := serve(NewShopApi(), r); w.Code != c.status {
+			t.Errorf("%s: %d %s", c.name, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	withConfig(t, WithDeadlineHeader("X-Timeout"))
+	cases := []struct {
+		name     string
+		wait     string
+		deadline string
+		status   int
+	}{
+		{"in time", "0", "", 200},
+		{"timeout of the method", "500", "", 504},
+		{"deadline of the client", "30", "5ms", 504},
+		// clients can't make it longer
+		{"capped deadline", "500", "10s", 504},
+		{"bad deadline", "0", "soon", 200},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/shop/quote?item=42&wait="+c.wait, nil)
+		r.Header.Set("X-Timeout", c.deadline)
+		start := time.Now()
+		w := serve(NewShopApi(), r)
+		if w.Code != c.status || c.status == 504 && !strings.Contains(w.Body.String(), `"error":"timeout"`) {
+			t.Errorf("%s: %d %s", c.name, w.Code, w.Body.String())
+		}
+		if took := time.Since(start); took > 300*time.Millisecond {
+			t.Errorf("%s: took %s", c.name, took)
+		}
+	}
+}
+
+func TestDeadlineHeaderOff(t *testing.T) {
+	withConfig(t)
+	r := httptest.NewRequest("GET", "/shop/quote?item=42&wait=30", nil)
+	r.Header.Set("X-Timeout", "5ms")
+	if w := serve(NewShopApi(), r); w.Code != 200 {
+		t.Errorf("%d %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"testing"
+)
+
+const (
+	traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	spanID  = "00f067aa0ba902b7"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	cases := []struct {
+		traceParent string
+		ok          bool
+		flags       byte
+	}{
+		{"00-" + traceID + "-" + spanID + "-01", true, 1},
+		{"00-" + traceID + "-" + spanID + "-00", true, 0},
+		// later versions may add fields
+		{"01-" + traceID + "-" + spanID + "-01-more", true, 1},
+		{"00-" + traceID + "-" + spanID + "-01-more", false, 0},
+		{"ff-" + traceID + "-" + spanID + "-01", false, 0},
+		{"00-00000000000000000000000000000000-" + spanID + "-01", false, 0},
+		{"00-" + traceID + "-0000000000000000-01", false, 0},
+		{"00-" + traceID[1:] + "-" + spanID + "-01", false, 0},
+		{"00-" + traceID + "-" + spanID + "-zz", false, 0},
+		{"00-" + traceID + "-xxf067aa0ba902b7-01", false, 0},
+		{"", false, 0},
+	}
+	for _, c := range cases {
+		sc, ok := ParseTraceParent(c.traceParent, "vendor=1")
+		if ok != c.ok {
+			t.Errorf("%q: ok is %v", c.traceParent, ok)
+			continue
+		}
+		if ok && (sc.Flags != c.flags || sc.TraceState != "vendor=1" || sc.TraceParent() != "00-"+traceID+"-"+spanID+fmt.Sprintf("-%02x", c.flags)) {
+			t.Errorf("%q: %+v", c.traceParent, sc)
+		}
+	}
+}
+
+func TestSpans(t *testing.T) {
+	tracer := &RecordingTracer{}
+	withConfig(t, WithTracer(tracer))
+	r := httptest.NewRequest("GET", "/user/profile?login=nobody", nil)
+	r.Header.Set("traceparent", "00-"+traceID+"-"+spanID+"-01")
+	r.Header.Set("tracestate", "vendor=1")
+	serve(NewMyApi(), r)
+	serve(NewMyApi(), httptest.NewRequest("GET", "/user/profile?login=rvasily", nil))
+
+	spans := tracer.Spans()
+	if len(spans) != 2 {
+		t.Fatalf("%d spans", len(spans))
+	}
+	continued, started := spans[0], spans[1]
+	if continued.Name != "MyApi.Profile" || !continued.Ended || continued.Status != 404 ||
+		continued.Attributes["http.route"] != "/user/profile" || continued.Attributes["http.method"] != "GET" {
+		t.Errorf("continued span: %+v", continued)
+	}
+	if continued.Parent.TraceParent() != "00-"+traceID+"-"+spanID+"-01" || continued.Context.TraceID != continued.Parent.TraceID ||
+		continued.Context.SpanID == continued.Parent.SpanID || continued.Context.TraceState != "vendor=1" {
+		t.Errorf("trace is not continued: %+v", continued)
+	}
+	if len(continued.Errors) != 1 || continued.Errors[0].Error() != "user not exist" {
+		t.Errorf("errors: %v", continued.Errors)
+	}
+	if started.Parent.IsValid() || !started.Context.IsValid() || started.Context.TraceID == continued.Context.TraceID ||
+		started.Status != 200 || len(started.Errors) != 0 {
+		t.Errorf("new span: %+v", started)
+	}
+}
+
+func TestSpansOff(t *testing.T) {
+	withConfig(t)
+	if DefaultHandlerConfig.Tracer != nil {
+		t.Errorf("tracer %T by default", DefaultHandlerConfig.Tracer)
+	}
+	if span := SpanFromContext(httptest.NewRequest("GET", "/", nil).Context()); span.SpanContext().IsValid() {
+		t.Errorf("span without a tracer: %+v", span.SpanContext())
+	}
+}